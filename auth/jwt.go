@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hoagie-profile/response"
 	"net/http"
 
 	jwtmiddleware "github.com/auth0/go-jwt-middleware"
@@ -111,6 +112,9 @@ func Middleware(domain string, audience string) *jwtmiddleware.JWTMiddleware {
 	return jwtmiddleware.New(jwtmiddleware.Options{
 		ValidationKeyGetter: keyFunc,
 		SigningMethod:       jwt.SigningMethodRS256,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err string) {
+			response.Write(w, response.Unauthorized(err))
+		},
 	})
 }
 
@@ -119,12 +123,12 @@ func CorsWrapper(runtimeMode string) *cors.Cors {
 	if runtimeMode == "debug" {
 		// CORS for development only
 		corsWrapper = cors.New(cors.Options{
-			AllowedMethods: []string{"GET", "POST"},
+			AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
 			AllowedHeaders: []string{"Content-Type", "Origin", "Accept", "*"},
 		})
 	} else {
 		corsWrapper = cors.New(cors.Options{
-			AllowedMethods: []string{"GET", "POST"},
+			AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
 			AllowedHeaders: []string{"Content-Type", "Origin", "Accept", "*"},
 			AllowedOrigins: []string{"https://*.hoagie.io"},
 		})
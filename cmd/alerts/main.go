@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"html"
+	"os"
+	"strings"
+	"time"
+
+	"hoagie-profile/config"
+	"hoagie-profile/db"
+	"hoagie-profile/format"
+	"hoagie-profile/mail"
+
+	"github.com/joho/godotenv"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type UserInfo struct {
+	Name  string
+	Email string
+}
+
+// Item details of a marketplace post, prices are in cents
+type MarketplaceInfo struct {
+	Price int64
+}
+
+type AlertPost struct {
+	Id          primitive.ObjectID `bson:"_id"`
+	Title       string
+	Description string
+	Category    string
+	Tags        []string
+	Email       string
+	User        UserInfo
+	Marketplace *MarketplaceInfo
+	Private     bool
+}
+
+// Saved search created through /stuff/searches
+type SavedSearch struct {
+	Email    string
+	Category string
+	Tags     []string
+	Keywords string
+	MaxPrice *int64 `bson:"maxPrice"`
+	// Posts already sent to the user of the search by a run that stopped
+	// before marking every post as alerted
+	AlertedPostIds []primitive.ObjectID `bson:"alertedPostIds"`
+}
+
+// Categories of the same group, such as the marketplace, match each other
+func sameCategory(a string, b string, taxonomy config.Taxonomy) bool {
+	return a == b || (taxonomy.Group(a) != "" && taxonomy.Group(a) == taxonomy.Group(b))
+}
+
+// Returns whether a post matches every condition of a saved search
+func (search SavedSearch) matches(post AlertPost, taxonomy config.Taxonomy) bool {
+	if search.Category != "" && !sameCategory(search.Category, post.Category, taxonomy) {
+		return false
+	}
+	for _, tag := range search.Tags {
+		found := false
+		for _, postTag := range post.Tags {
+			if tag == postTag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if search.MaxPrice != nil && (post.Marketplace == nil || post.Marketplace.Price > *search.MaxPrice) {
+		return false
+	}
+	text := strings.ToLower(post.Title + " " + format.PlainText(post.Description) + " " + strings.Join(post.Tags, " "))
+	for _, keyword := range strings.Fields(strings.ToLower(search.Keywords)) {
+		if !strings.Contains(text, keyword) {
+			return false
+		}
+	}
+	return true
+}
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "only print the alerts that would be sent")
+	flag.Parse()
+	// Like the digest, alerts are only sent in production
+	runAlertsScript(*dryRun || os.Getenv("HOAGIE_MODE") != "production")
+}
+
+// Checks the posts created since the last run against every saved search
+// and sends each user a single email with all of their new matches
+func runAlertsScript(dryRun bool) {
+	godotenv.Load(".env.local")
+
+	client, err := db.MongoClient()
+	if err != nil {
+		panic("Database connection error " + err.Error())
+	}
+	ctx := context.Background()
+	defer client.Disconnect(ctx)
+
+	posts, err := newPosts(client, ctx)
+	if err != nil {
+		panic("Error getting new posts " + err.Error())
+	}
+	if len(posts) == 0 {
+		fmt.Println("No new posts found...")
+		return
+	}
+	searches, err := savedSearches(client, ctx)
+	if err != nil {
+		panic("Error getting saved searches " + err.Error())
+	}
+	taxonomy, err := config.LoadTaxonomy(client)
+	if err != nil {
+		panic("Error getting categories " + err.Error())
+	}
+
+	emails, alerts := collectAlerts(posts, searches, taxonomy)
+	fmt.Printf("%d new posts, %d alert emails\n", len(posts), len(emails))
+	if dryRun {
+		for _, email := range emails {
+			message := alertMessage(email, alerts[email])
+			fmt.Printf("To: %s\nSubject: %s\n%s\n", message.To, message.Subject, message.Text)
+		}
+		return
+	}
+
+	// The searches of each batch are marked as soon as it is sent, so that
+	// a failed run resumes where it stopped without sending alerts twice
+	for start := 0; start < len(emails); start += mail.BATCH_SIZE {
+		end := start + mail.BATCH_SIZE
+		if end > len(emails) {
+			end = len(emails)
+		}
+		batch := emails[start:end]
+		var messages []mail.Message
+		for _, email := range batch {
+			messages = append(messages, alertMessage(email, alerts[email]))
+		}
+		if err := mail.Send(client, "Hoagie Stuff", messages); err != nil {
+			panic("Error sending alerts " + err.Error())
+		}
+		for _, email := range batch {
+			var postIds []primitive.ObjectID
+			for _, post := range alerts[email] {
+				postIds = append(postIds, post.Id)
+			}
+			_, err := db.UpdateMany(client, "apps", "searches",
+				bson.D{{Key: "email", Value: email}},
+				bson.D{{Key: "$addToSet", Value: bson.D{{Key: "alertedPostIds", Value: bson.D{{Key: "$each", Value: postIds}}}}}},
+				options.Update())
+			if err != nil {
+				panic("Error marking searches as alerted " + err.Error())
+			}
+		}
+	}
+
+	// Once every alert is sent, the posts are marked and no longer need to
+	// be remembered by the searches
+	var postIds []primitive.ObjectID
+	for _, post := range posts {
+		postIds = append(postIds, post.Id)
+	}
+	_, err = db.UpdateMany(client, "apps", "stuff",
+		bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: postIds}}}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "alerted", Value: true}}}},
+		options.Update())
+	if err != nil {
+		panic("Error marking posts as alerted " + err.Error())
+	}
+	_, err = db.UpdateMany(client, "apps", "searches",
+		bson.D{{Key: "alertedPostIds", Value: bson.D{{Key: "$in", Value: postIds}}}},
+		bson.D{{Key: "$pull", Value: bson.D{{Key: "alertedPostIds", Value: bson.D{{Key: "$in", Value: postIds}}}}}},
+		options.Update())
+	if err != nil {
+		panic("Error clearing alerted posts of searches " + err.Error())
+	}
+	fmt.Println("Successfully sent alerts.")
+}
+
+// Groups the posts matching saved searches by the user to alert, in the
+// order the users were first matched. Each post is only listed once per
+// user, however many searches it matches, and posts a user was already
+// alerted to are left out.
+func collectAlerts(posts []AlertPost, searches []SavedSearch, taxonomy config.Taxonomy) ([]string, map[string][]AlertPost) {
+	sent := map[string]map[primitive.ObjectID]bool{}
+	for _, search := range searches {
+		if sent[search.Email] == nil {
+			sent[search.Email] = map[primitive.ObjectID]bool{}
+		}
+		for _, id := range search.AlertedPostIds {
+			sent[search.Email][id] = true
+		}
+	}
+
+	alerts := make(map[string][]AlertPost)
+	var emails []string
+	for _, post := range posts {
+		alerted := map[string]bool{}
+		for _, search := range searches {
+			if search.Email == post.Email || alerted[search.Email] || sent[search.Email][post.Id] || !search.matches(post, taxonomy) {
+				continue
+			}
+			alerted[search.Email] = true
+			if len(alerts[search.Email]) == 0 {
+				emails = append(emails, search.Email)
+			}
+			alerts[search.Email] = append(alerts[search.Email], post)
+		}
+	}
+	return emails, alerts
+}
+
+// Get the active posts that have not been checked against saved searches yet
+func newPosts(client *mongo.Client, ctx context.Context) ([]AlertPost, error) {
+	filter := bson.D{
+		{Key: "alerted", Value: false},
+		{Key: "state", Value: bson.D{{Key: "$ne", Value: "resolved"}}},
+		{Key: "hidden", Value: bson.D{{Key: "$ne", Value: true}}},
+		{Key: "expiresAt", Value: bson.D{{Key: "$gt", Value: time.Now()}}},
+	}
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{Key: "createdAt", Value: 1}})
+	cursor, err := db.FindMany(client, "apps", "stuff", filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var posts []AlertPost
+	err = cursor.All(ctx, &posts)
+	return posts, err
+}
+
+func savedSearches(client *mongo.Client, ctx context.Context) ([]SavedSearch, error) {
+	cursor, err := db.FindMany(client, "apps", "searches", bson.D{}, options.Find())
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var searches []SavedSearch
+	err = cursor.All(ctx, &searches)
+	return searches, err
+}
+
+func alertMessage(email string, posts []AlertPost) mail.Message {
+	subject := fmt.Sprintf("🔔 New on Hoagie Stuff: %s", posts[0].Title)
+	if len(posts) > 1 {
+		subject = fmt.Sprintf("🔔 %d new posts match your saved searches", len(posts))
+	}
+	manage := "You are getting this email because of your saved searches. Manage them on Hoagie Stuff."
+
+	var body, text strings.Builder
+	body.WriteString(`<div style="font-family: sans-serif;">`)
+	body.WriteString("<p>New posts on Hoagie Stuff match your saved searches:</p><hr />")
+	text.WriteString("New posts on Hoagie Stuff match your saved searches:\n\n")
+	for _, post := range posts {
+		body.WriteString(fmt.Sprintf("<span><b>%s</b></span><br />", html.EscapeString(post.Title)))
+		body.WriteString(fmt.Sprintf("<div style='margin:5px 0px;'>%s</div>", html.EscapeString(post.Description)))
+		text.WriteString(post.Title + "\n" + strings.TrimSpace(format.PlainText(post.Description)) + "\n")
+		if post.Marketplace != nil {
+			body.WriteString("<span><b>Price: </b>" + format.Price(post.Marketplace.Price) + "</span><br />")
+			text.WriteString("Price: " + format.Price(post.Marketplace.Price) + "\n")
+		}
+		// Private posts are only reachable through the contact relay
+		if post.Private {
+			body.WriteString(fmt.Sprintf(`<span><b>Contact: </b>%s (<a target="_blank" href="https://stuff.hoagie.io/">message on Hoagie Stuff</a>)</span><br /><hr />`,
+				html.EscapeString(post.User.Name)))
+			text.WriteString(fmt.Sprintf("Contact: %s (message on Hoagie Stuff)\n\n", post.User.Name))
+		} else {
+			body.WriteString(fmt.Sprintf("<span><b>Contact: </b>%s (<a href=\"mailto:%s\">%s</a>)</span><br /><hr />",
+				html.EscapeString(post.User.Name), html.EscapeString(post.Email), html.EscapeString(post.Email)))
+			text.WriteString(fmt.Sprintf("Contact: %s (%s)\n\n", post.User.Name, post.Email))
+		}
+	}
+	body.WriteString(`<p>See all posts at <a target="_blank" href="https://stuff.hoagie.io/">stuff.hoagie.io</a>.</p>`)
+	unsubscribeURL := mail.UnsubscribeURL(email, mail.ListAlerts)
+	body.WriteString(fmt.Sprintf(`<p style="font-size:8pt;">%s <a target="_blank" href="%s">Stop all alerts</a></p></div>`,
+		manage, html.EscapeString(unsubscribeURL)))
+	text.WriteString(manage + "\nStop all alerts: " + unsubscribeURL + "\n")
+
+	return mail.Message{
+		To:       email,
+		Subject:  subject,
+		HTML:     body.String(),
+		Text:     text.String(),
+		CustomID: "stuff-alert",
+		List:     mail.ListAlerts,
+	}
+}
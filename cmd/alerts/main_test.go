@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+
+	"hoagie-profile/config"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCollectAlertsSkipsPostsAlreadySent(t *testing.T) {
+	lamp := AlertPost{Id: primitive.NewObjectID(), Title: "Lamp", Category: "sale", Email: "seller@princeton.edu"}
+	desk := AlertPost{Id: primitive.NewObjectID(), Title: "Desk", Category: "sale", Email: "seller@princeton.edu"}
+	searches := []SavedSearch{
+		{Email: "a@princeton.edu", Category: "sale"},
+		{Email: "a@princeton.edu", Keywords: "lamp"},
+		{Email: "b@princeton.edu", Category: "sale", AlertedPostIds: []primitive.ObjectID{lamp.Id}},
+		{Email: "seller@princeton.edu", Category: "sale"},
+	}
+
+	emails, alerts := collectAlerts([]AlertPost{lamp, desk}, searches, config.DefaultTaxonomy())
+	if len(emails) != 2 || emails[0] != "a@princeton.edu" || emails[1] != "b@princeton.edu" {
+		t.Fatalf("emails = %v, want a and b", emails)
+	}
+	if got := alerts["a@princeton.edu"]; len(got) != 2 {
+		t.Errorf("a was alerted to %d posts, want each post once", len(got))
+	}
+	if got := alerts["b@princeton.edu"]; len(got) != 1 || got[0].Id != desk.Id {
+		t.Errorf("b was alerted to %v, want only the desk", got)
+	}
+}
@@ -2,104 +2,38 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
-	"strings"
 	"time"
 
 	"hoagie-profile/db"
+	"hoagie-profile/digest"
+	"hoagie-profile/mail"
 
 	"github.com/joho/godotenv"
 	"github.com/mailjet/mailjet-apiv3-go"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
-var REQUEST_TIMEOUT = 10 * time.Second
-var SUMMER = false
-var sandwich = `<img height="22" src='https://i.imgur.com/gkEZQ4x.png' title='Hoagie' />`
-var logo = `<img height="180px" src='https://i.imgur.com/kidY9cT.png' alt='Hoagie Digest' />`
-
-type UserInfo struct {
-	Name  string
-	Email string
-}
-
-type DigestObject struct {
-	Title       string
-	Category    string
-	Contact     string
-	Description string
-	Link        string
-	Thumbnail   string
-	Name        string
-	Email       string
-	Tags        []string
-	User        UserInfo
-}
-
-func link(text string, link string) string {
-	return fmt.Sprintf("<a target='_blank' href=\"%s\">%s</a>", link, text)
-}
-
-func link_mail(text string) string {
-	return link(text, "mailto:"+text)
-}
-
-func formatTag(text string) string {
-	return fmt.Sprintf(`<span style="color: #474d66; background-color:#edeff5; padding: 0px 6px; border-radius:4px; margin-right: 1px;">%s</span>`, strings.Title(text))
-}
-
-func addTags(email *strings.Builder, tags []string) {
-	email.WriteString("<div style='margin-top: 6px;'>")
-	for _, tag := range tags {
-		email.WriteString(formatTag(tag) + " ")
-	}
-	email.WriteString("</div>")
+func main() {
+	dryRun := flag.Bool("dry-run", false, "only print the next digest and the posts it includes")
+	flag.Parse()
+	runDigestScript(*dryRun)
 }
 
-func formatMessage(message DigestObject) string {
-	var email strings.Builder
-	name := message.User.Name
-	if name == "" {
-		// TODO: Old version, remove
-		name = message.Name
-	}
-	switch message.Category {
-	case "sale":
-		tags := message.Tags
-		if tags == nil || len(tags) == 0 {
-			tags = strings.Split(message.Title, ", ")
-		}
-		// TODO: Old version, remove
-		if len(message.Link) > 0 {
-			email.WriteString("<span><a target='_blank' href=\"" + message.Link + "\">Open Sale Slides</a></span><br />")
-		}
-		email.WriteString(fmt.Sprintf("<div style='margin:10px 0px;'>%s</div>", message.Description))
-		email.WriteString(fmt.Sprintf("<span><b>Contact: </b>%s (%s)</span><br />", name, link_mail(message.Email)))
-		addTags(&email, tags)
-	case "lost":
-		if len(message.Thumbnail) > 0 {
-			email.WriteString("<span><a target='_blank' href=\"" + message.Thumbnail + "\">See Picture</a></span><br />")
+func printSummary(nextDigest digest.Digest) {
+	for _, section := range nextDigest.Summary() {
+		fmt.Printf("%s (%d posts)\n", section.Title, len(section.Posts))
+		for _, post := range section.Posts {
+			fmt.Printf("  %s %s\n", post.Id, post.Title)
 		}
-		email.WriteString("<span><b>" + strings.ToUpper(message.Tags[0]) + ": </b>" + message.Title + "</span><br />")
-		email.WriteString("<div style='margin:5px 0px;'>" + message.Description + "</div>")
-		email.WriteString(fmt.Sprintf("<span><b>Contact: </b>%s (%s)</span><br />", name, link_mail(message.Email)))
-	default:
-		email.WriteString("<span><b>" + message.Title + "</b></span><br />")
-		email.WriteString("<div style='margin:5px 0px;'>" + message.Description + "</div>")
-		email.WriteString(fmt.Sprintf("<span><b>From: </b>%s (%s)</span><br />", name, link_mail(message.Email)))
-		addTags(&email, message.Tags)
 	}
-
-	return email.String()
-}
-
-func main() {
-	runDigestScript()
 }
 
-func runDigestScript() {
+func runDigestScript(dryRun bool) {
 	godotenv.Load(".env.local")
 
 	client, err := db.MongoClient()
@@ -109,132 +43,112 @@ func runDigestScript() {
 	ctx := context.Background()
 	defer client.Disconnect(ctx)
 
-	cursor, err := db.FindMany(client, "apps", "stuff", bson.D{{"sent", false}}, options.Find())
+	now := time.Now()
+	sendListservDigest(client, now, dryRun)
+
+	// Subscribers get the posts of the listserv digests sent since their
+	// last personal digest, including the one that was just sent. Like the
+	// listserv digest, they are only sent in production.
+	personalDryRun := dryRun || os.Getenv("HOAGIE_MODE") != "production"
+	sent, err := digest.SendPersonal(client, now, personalDryRun)
 	if err != nil {
-		panic("Error getting digest emails" + err.Error())
+		panic("Error sending personal digests " + err.Error())
+	}
+	if !personalDryRun {
+		fmt.Printf("Sent %d personal digests.\n", sent)
 	}
-	defer cursor.Close(ctx)
+}
 
-	digest := make(map[string][]DigestObject)
-	total := 0
-	for cursor.Next(ctx) {
-		var message DigestObject
-		if err = cursor.Decode(&message); err != nil {
-			fmt.Printf("Error decoding digest email: %s", err)
-			return
+// Sends the digest of the pending posts to every residential listserv
+func sendListservDigest(client *mongo.Client, now time.Time, dryRun bool) {
+	// Finish earlier runs that stopped between sending and marking posts,
+	// so their posts are not sent twice
+	if !dryRun && os.Getenv("HOAGIE_MODE") == "production" {
+		reconciled, err := digest.Reconcile(client)
+		if err != nil {
+			panic("Error finishing earlier digests " + err.Error())
+		}
+		if reconciled > 0 {
+			fmt.Printf("Finished %d earlier digest runs.\n", reconciled)
 		}
-		cat := message.Category
-		digest[cat] = append(digest[cat], message)
-		total += 1
 	}
+
+	// Digest days, summer ranges and the intro are set in the digest config
+	nextDigest, digestConfig, err := digest.Next(client, now)
+	if err != nil {
+		panic("Error getting digest emails " + err.Error())
+	}
+
+	// A dry run never sends the digest or marks posts as sent
+	if dryRun {
+		preview, err := nextDigest.Preview(digestConfig)
+		if err != nil {
+			panic("Error rendering digest " + err.Error())
+		}
+		fmt.Println(preview.HTML)
+		fmt.Printf("Subject: %s\n", preview.Subject)
+		printSummary(nextDigest)
+		fmt.Printf("%d posts, would be sent now: %t\n", preview.Total, preview.WillSend)
+		return
+	}
+
+	total := nextDigest.Total
 	if total < 1 {
 		fmt.Println("No messages found...")
 		return
-	} else if total < 5 {
-		// If there are less than 5 posts,
-		// only send the Digest if it is a digest day and not summer!
-		weekday := time.Now().Weekday()
-		allowedDates := []time.Weekday{
-			time.Tuesday, time.Thursday, time.Saturday,
-		}
-		isDigestDay := false
-		if !SUMMER {
-			for _, allowedDate := range allowedDates {
-				if weekday == allowedDate {
-					fmt.Println("Today is a Digest Day... Running...")
-					isDigestDay = true
-					break
-				}
-			}
-		}
-		if !isDigestDay {
-			fmt.Println("Not a Digest Day... Exiting...")
-			return
-		}
+	} else if !digestConfig.ShouldSend(total, now) {
+		fmt.Println("Not a Digest Day... Exiting...")
+		return
+	} else if total >= digestConfig.MinPosts {
+		fmt.Printf("%d or more Digest posts... Running...\n", digestConfig.MinPosts)
 	} else {
-		fmt.Println("5 or more Digest posts... Running...")
+		fmt.Println("Today is a Digest Day... Running...")
 	}
 
-	var email strings.Builder
-	email.WriteString(`<div style="
-	font-family: sans-serif;
-	">`)
-	email.WriteString(fmt.Sprintf("<center>%s</center>", logo))
-	if !SUMMER {
-		email.WriteString(`<p><br />Here is a weekly digest of posts made to <a href="https://stuff.hoagie.io/">Hoagie Stuff</a>, 
-	from Sales to Lost & Found and more, sent every Tuesday, Thursday, and Saturday.</p>`)
-	} else {
-		email.WriteString(`<p><br />Here is a digest of posts made to <a href="https://stuff.hoagie.io/">Hoagie Stuff</a></p> over past few days. It's Summer, so Hoagie is taking things slow.</p>`)
+	body, err := nextDigest.HTML()
+	if err != nil {
+		panic("Error rendering digest " + err.Error())
 	}
-	email.WriteString(`<p>
-	<a target="_blank" href="https://stuff.hoagie.io/">Open Hoagie Stuff</a> |
-	<a target="_blank" href="https://stuff.hoagie.io/create">Add your message to next digest</a> | 
-	<a target="_blank" href="https://tally.so/r/mYJjN3">Give feedback</a>
-	</p>`)
-
-	email.WriteString("<hr />")
-	if len(digest["lost"]) > 0 {
-		email.WriteString("<h2>🧭 Lost & Found</h2>")
-		email.WriteString(`<div style="margin-bottom:20px; margin-top:-10px;">Access anytime through <a href="https://stuff.hoagie.io/lost">stuff.hoagie.io/lost</a></div>`)
-		for i, message := range digest["lost"] {
-			email.WriteString(formatMessage(message))
-			if i == len(digest["lost"])-1 {
-				email.WriteString("<br />")
-			}
-			email.WriteString("<hr />")
-		}
+	text, err := nextDigest.Text()
+	if err != nil {
+		panic("Error rendering digest " + err.Error())
 	}
-	if len(digest["sale"]) > 0 {
-		email.WriteString("<h2>🛍️ Marketplace</h2>")
-		email.WriteString(`<div style="margin-bottom:20px; margin-top:-10px;">Accessible anytime with <a href="https://stuff.hoagie.io/marketplace">stuff.hoagie.io/marketplace</a></div>`)
-		for i, message := range digest["sale"] {
-			email.WriteString(formatMessage(message))
-			if i == len(digest["sale"])-1 {
-				email.WriteString("<br />")
-			}
-			email.WriteString("<hr />")
-		}
+	fmt.Println(body)
+	if os.Getenv("HOAGIE_MODE") != "production" {
+		return
 	}
-	if len(digest["bulletin"]) > 0 {
-		email.WriteString("<h2>✉️ Bulletins</h2>")
-		email.WriteString(`<div style="margin-bottom:20px; margin-top:-10px;">Accessible anytime with <a href="https://stuff.hoagie.io/bulletins">stuff.hoagie.io/bulletins</a></div>`)
-		for i, message := range digest["bulletin"] {
-			email.WriteString(formatMessage(message))
-			if i == len(digest["bulletin"])-1 {
-				email.WriteString("<br />")
-			}
-			email.WriteString("<hr />")
+
+	// The posts of a digest are only marked as sent once Mailjet accepts it,
+	// so a failed run leaves them for the next one
+	record, err := digest.CreateRecord(client, nextDigest, body, text)
+	if err != nil {
+		panic("Error recording digest " + err.Error())
+	}
+	sent, err := makeRequest(client, record.Id, MailRequest{
+		Header: record.Subject,
+		Sender: "Hoagie Mail",
+		Body:   body,
+		Text:   text,
+		Email:  "hoagie@princeton.edu",
+	})
+	// A digest that went out but could not be recorded is still marked as
+	// sent, and the run fails so that it is looked into
+	notRecorded := errors.Is(err, mail.ErrNotRecorded)
+	if err != nil && !notRecorded {
+		if markErr := digest.MarkFailed(client, record, err); markErr != nil {
+			fmt.Println("Error recording failed digest:", markErr)
 		}
+		fmt.Printf("Digest %s could not be sent: %s\n", record.Id.Hex(), err)
+		os.Exit(1)
 	}
-	if total != 1 {
-		email.WriteString(fmt.Sprintf(`<p>That's all! This could have been %d emails in your inbox but instead it is just one!<br /><br /></p>
-		`, total))
+	fmt.Println("Successfully sent via Hoagie Mail.")
+	if err := digest.MarkSent(client, record, sent.MessageIDs); err != nil {
+		panic("Error marking digest posts as sent " + err.Error())
 	}
-	email.WriteString(`<p>You don't need to wait for the next digest to see what's new, check out the <a target="_blank" href="https://stuff.hoagie.io/">Hoagie Stuff</a>
-		to keep up to date with the latest posts before others.</p>`)
-	email.WriteString(fmt.Sprintf(`
-		<center>
-		%s <br />
-		<div style="font-size:8pt; margin-top:8px;">
-		Powered by <a target="_blank" href="https://mail.hoagie.io/">HoagieMail</a><br />
-		In the Hoagie world, hoagies digest you!
-		</div>
-		</center>
-	`, sandwich))
-	email.WriteString("</div>")
-	fmt.Println(email.String())
-	if os.Getenv("HOAGIE_MODE") == "production" {
-		makeRequest(MailRequest{
-			Header: fmt.Sprintf(
-				"📬 DIGEST %s: Sales, Lost & Found, and more!",
-				time.Now().Format("1/2")),
-			Sender: "Hoagie Mail",
-			Body:   email.String(),
-			Email:  "hoagie@princeton.edu",
-		})
-		fmt.Println("Successfully sent via Hoagie Mail.")
-		db.UpdateMany(client, "apps", "stuff", bson.D{{"sent", false}}, bson.D{{"$set", bson.D{{"sent", true}}}}, options.Update())
-
+	fmt.Printf("Marked %d posts as sent in digest %s.\n", len(record.PostIds), record.Id.Hex())
+	if notRecorded {
+		fmt.Printf("Digest %s was sent but not recorded in apps.sent: %s\n", record.Id.Hex(), err)
+		os.Exit(1)
 	}
 }
 
@@ -242,11 +156,13 @@ type MailRequest struct {
 	Header string
 	Sender string
 	Body   string
+	Text   string
 	Email  string
 }
 
-func makeRequest(req MailRequest) error {
-	mailjetClient := mailjet.NewMailjetClient(os.Getenv("MAILJET_PUBLIC_KEY"), os.Getenv("MAILJET_PRIVATE_KEY"))
+// Sends the digest to every listserv, recording the sent message under
+// the ID of the digest
+func makeRequest(client *mongo.Client, id primitive.ObjectID, req MailRequest) (db.SentMessage, error) {
 	messagesInfo := []mailjet.InfoMessagesV31{
 		{
 			From: &mailjet.RecipientV31{
@@ -298,18 +214,10 @@ func makeRequest(req MailRequest) error {
 				},
 			},
 			Subject:  req.Header,
-			TextPart: req.Body,
+			TextPart: req.Text,
 			HTMLPart: req.Body,
 			CustomID: "HoagieStuffDigest",
 		},
 	}
-	messages := mailjet.MessagesV31{Info: messagesInfo}
-	res, err := mailjetClient.SendMailV31(&messages)
-	if err != nil {
-		return err
-	}
-	if len(res.ResultsV31) > 0 && res.ResultsV31[0].Status == "success" {
-		return nil
-	}
-	return fmt.Errorf("mail service received an error, possibly because of limits")
+	return mail.SendTracked(client, id, req.Email, messagesInfo[0])
 }
@@ -2,26 +2,30 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"time"
 
 	"hoagie-profile/db"
+	"hoagie-profile/mail"
 
 	godotenv "github.com/joho/godotenv"
 	mailjet "github.com/mailjet/mailjet-apiv3-go"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type MailRequest struct {
-	Header string
-	Sender string
-	Body   string
-	Email  string
-	UserName string
-	Schedule time.Time
-	CreatedAt time.Time
+	Header    string    `bson:"header"`
+	Sender    string    `bson:"sender"`
+	Body      string    `bson:"body"`
+	Email     string    `bson:"email"`
+	UserName  string    `bson:"userName"`
+	Schedule  time.Time `bson:"schedule"`
+	CreatedAt time.Time `bson:"createdAt"`
 }
 
 func main() {
@@ -48,9 +52,9 @@ func runScheduledSendScript() {
 
 	// Grace period of 60 minutes because Heroku Scheduler isn't exact
 	filter := bson.D{
-		{"Schedule", bson.D{
-        	{"$lte", currentTimeEST},
-    	}},
+		{Key: "schedule", Value: bson.D{
+			{Key: "$lte", Value: currentTimeEST},
+		}},
 	}
 	cursor, err := db.FindMany(client, "apps", "mail", filter, options.Find())
 	if err != nil {
@@ -87,7 +91,7 @@ func runScheduledSendScript() {
 		} 
 
 		if os.Getenv("HOAGIE_MODE") == "production" {
-			err = makeRequest(mailReq)
+			err = makeRequest(client, mailReq)
 			if err != nil {
 				fmt.Println(err)
 				errorTotal++
@@ -95,10 +99,10 @@ func runScheduledSendScript() {
 			}
 		}
 		currentMailFilter := bson.D{
-			{"Email", mailReq.Email},
-			{"Sender", mailReq.Sender},
-			{"Header", mailReq.Header},
-			{"Schedule", mailReq.Schedule},
+			{Key: "email", Value: mailReq.Email},
+			{Key: "sender", Value: mailReq.Sender},
+			{Key: "header", Value: mailReq.Header},
+			{Key: "schedule", Value: mailReq.Schedule},
 		}
 		db.DeleteOne(client, "apps", "mail", currentMailFilter)
 		total++
@@ -113,8 +117,7 @@ func runScheduledSendScript() {
 	}
 }
 
-func makeRequest(req MailRequest) error {
-	mailjetClient := mailjet.NewMailjetClient(os.Getenv("MAILJET_PUBLIC_KEY"), os.Getenv("MAILJET_PRIVATE_KEY"))
+func makeRequest(client *mongo.Client, req MailRequest) error {
 	messagesInfo := []mailjet.InfoMessagesV31{
 		{
 			From: &mailjet.RecipientV31{
@@ -171,13 +174,11 @@ func makeRequest(req MailRequest) error {
 			CustomID: "HoagieMail",
 		},
 	}
-	messages := mailjet.MessagesV31{Info: messagesInfo}
-	res, err := mailjetClient.SendMailV31(&messages)
-	if err != nil {
-		return err
-	}
-	if len(res.ResultsV31) > 0 && res.ResultsV31[0].Status == "success" {
+	_, err := mail.SendTracked(client, primitive.NewObjectID(), req.Email, messagesInfo[0])
+	// The email went out, only its delivery stats are missing
+	if errors.Is(err, mail.ErrNotRecorded) {
+		fmt.Println("Error recording sent mail:", err)
 		return nil
 	}
-	return fmt.Errorf("mail service received an error, possibly because of limits")
+	return err
 }
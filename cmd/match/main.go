@@ -0,0 +1,381 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"time"
+
+	"hoagie-profile/config"
+	"hoagie-profile/db"
+	"hoagie-profile/format"
+	"hoagie-profile/mail"
+
+	"github.com/joho/godotenv"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Found items are matched with lost items that were lost at most a day
+// after they were found, in case of time zones, and at most 30 days before
+var MATCH_WINDOW = 30 * 24 * time.Hour
+var MATCH_LEEWAY = 24 * time.Hour
+
+// Minimum score for a pair of posts to be suggested as a match. Posts at
+// the same location always pass it, posts elsewhere need similar text.
+var MATCH_THRESHOLD = 0.4
+
+const (
+	locationWeight = 0.4
+	textWeight     = 0.6
+)
+
+type UserInfo struct {
+	Name  string
+	Email string
+}
+
+// Details of a lost & found post
+type LostFoundInfo struct {
+	Kind      string
+	Date      time.Time
+	Location  string
+	ItemType  string `bson:"itemType"`
+	NoMatches bool   `bson:"noMatches"`
+}
+
+type MatchPost struct {
+	Id          primitive.ObjectID `bson:"_id"`
+	Title       string
+	Description string
+	Email       string
+	User        UserInfo
+	LostFound   LostFoundInfo `bson:"lostFound"`
+	Private     bool
+	// Set once the post has been compared against the open posts
+	MatchCheckedAt time.Time `bson:"matchCheckedAt"`
+}
+
+// A suggested pair of lost and found posts, kept in apps.matches so that
+// every pair is only suggested once
+type Match struct {
+	Lost  MatchPost
+	Found MatchPost
+	Score float64
+}
+
+var wordPattern = regexp.MustCompile(`[a-z0-9]+`)
+
+// Words that say nothing about the item itself
+var stopWords = map[string]bool{
+	"the": true, "and": true, "for": true, "with": true, "near": true,
+	"lost": true, "found": true, "was": true, "has": true, "have": true,
+	"this": true, "that": true, "left": true, "please": true, "contact": true,
+	"someone": true, "anyone": true, "around": true, "from": true, "email": true,
+}
+
+func words(post MatchPost) map[string]bool {
+	result := map[string]bool{}
+	text := strings.ToLower(post.Title + " " + format.PlainText(post.Description))
+	for _, word := range wordPattern.FindAllString(text, -1) {
+		if len(word) >= 3 && !stopWords[word] {
+			result[word] = true
+		}
+	}
+	return result
+}
+
+// Jaccard similarity of the words of two posts, from 0 to 1
+func textSimilarity(a MatchPost, b MatchPost) float64 {
+	wordsA, wordsB := words(a), words(b)
+	shared := 0
+	for word := range wordsA {
+		if wordsB[word] {
+			shared++
+		}
+	}
+	total := len(wordsA) + len(wordsB) - shared
+	if total == 0 {
+		return 0
+	}
+	return float64(shared) / float64(total)
+}
+
+func locationSimilarity(a string, b string) float64 {
+	if a == b && a != "other" {
+		return 1
+	}
+	// Items found somewhere unlisted may well be the same
+	if a == "other" || b == "other" {
+		return 0.5
+	}
+	return 0
+}
+
+// Scores how likely a found post is about a lost item, from 0 to 1.
+// Items of different types, or found well before or after the item was
+// lost, never match.
+func score(lost MatchPost, found MatchPost) float64 {
+	if lost.LostFound.ItemType != found.LostFound.ItemType {
+		return 0
+	}
+	lostAt, foundAt := lost.LostFound.Date, found.LostFound.Date
+	if foundAt.Before(lostAt.Add(-MATCH_LEEWAY)) || foundAt.After(lostAt.Add(MATCH_WINDOW)) {
+		return 0
+	}
+	return locationWeight*locationSimilarity(lost.LostFound.Location, found.LostFound.Location) +
+		textWeight*textSimilarity(lost, found)
+}
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "only print the matches that would be suggested")
+	flag.Parse()
+	runMatchScript(*dryRun)
+}
+
+// Compares lost & found posts that have not been checked yet against the
+// open posts of the other kind, and emails both parties of every new match
+func runMatchScript(dryRun bool) {
+	godotenv.Load(".env.local")
+
+	client, err := db.MongoClient()
+	if err != nil {
+		panic("Database connection error " + err.Error())
+	}
+	ctx := context.Background()
+	defer client.Disconnect(ctx)
+
+	taxonomy, err := config.LoadTaxonomy(client)
+	if err != nil {
+		panic("Error loading categories " + err.Error())
+	}
+	lost, found, err := openPosts(client, ctx, taxonomy)
+	if err != nil {
+		panic("Error getting lost & found posts " + err.Error())
+	}
+
+	var matches []Match
+	var checked []primitive.ObjectID
+	seen := map[[2]primitive.ObjectID]bool{}
+	addMatches := func(newPosts []MatchPost, isLost bool, others []MatchPost) {
+		for _, post := range newPosts {
+			if !post.MatchCheckedAt.IsZero() {
+				continue
+			}
+			checked = append(checked, post.Id)
+			for _, other := range others {
+				match := Match{Lost: post, Found: other}
+				if !isLost {
+					match = Match{Lost: other, Found: post}
+				}
+				pair := [2]primitive.ObjectID{match.Lost.Id, match.Found.Id}
+				if seen[pair] || match.Lost.Email == match.Found.Email {
+					continue
+				}
+				seen[pair] = true
+				if match.Score = score(match.Lost, match.Found); match.Score >= MATCH_THRESHOLD {
+					matches = append(matches, match)
+				}
+			}
+		}
+	}
+	addMatches(found, false, lost)
+	addMatches(lost, true, found)
+
+	fmt.Printf("Checked %d new posts, found %d possible matches\n", len(checked), len(matches))
+	for _, match := range matches {
+		fmt.Printf("%.2f: lost %q (%s) <-> found %q (%s)\n", match.Score,
+			match.Lost.Title, match.Lost.Id.Hex(), match.Found.Title, match.Found.Id.Hex())
+	}
+	if dryRun {
+		return
+	}
+
+	// A match is recorded before it is sent so it is only sent once, and
+	// forgotten if sending fails so the next run tries it again
+	retry := map[primitive.ObjectID]bool{}
+	for _, match := range matches {
+		isNew, err := recordMatch(client, match)
+		if err != nil {
+			fmt.Println("Error recording match:", err)
+			retry[match.Lost.Id], retry[match.Found.Id] = true, true
+			continue
+		}
+		if !isNew {
+			continue
+		}
+		if err := mail.Send(client, "Hoagie Stuff", matchMessages(match)); err != nil {
+			fmt.Println("Error sending match suggestion:", err)
+			if err := forgetMatch(client, match); err != nil {
+				fmt.Println("Error forgetting unsent match:", err)
+			}
+			retry[match.Lost.Id], retry[match.Found.Id] = true, true
+		}
+	}
+	checked = withoutPosts(checked, retry)
+
+	if len(checked) > 0 {
+		_, err = db.UpdateMany(client, "apps", "stuff",
+			bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: checked}}}},
+			bson.D{{Key: "$set", Value: bson.D{{Key: "matchCheckedAt", Value: time.Now()}}}},
+			options.Update())
+		if err != nil {
+			panic("Error marking posts as checked " + err.Error())
+		}
+	}
+}
+
+// Filter for the posts of every category of the lost & found group that
+// are neither resolved, hidden nor expired
+func openFilter(taxonomy config.Taxonomy, now time.Time) bson.D {
+	return bson.D{
+		{Key: "category", Value: bson.D{{Key: "$in", Value: taxonomy.GroupCategories("lost")}}},
+		{Key: "lostFound", Value: bson.D{{Key: "$exists", Value: true}}},
+		{Key: "state", Value: bson.D{{Key: "$ne", Value: "resolved"}}},
+		{Key: "hidden", Value: bson.D{{Key: "$ne", Value: true}}},
+		{Key: "expiresAt", Value: bson.D{{Key: "$gt", Value: now}}},
+	}
+}
+
+// Get the open lost & found posts, split by their kind
+func openPosts(client *mongo.Client, ctx context.Context, taxonomy config.Taxonomy) ([]MatchPost, []MatchPost, error) {
+	cursor, err := db.FindMany(client, "apps", "stuff", openFilter(taxonomy, time.Now()), options.Find())
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var lost, found []MatchPost
+	for cursor.Next(ctx) {
+		var post MatchPost
+		if err := cursor.Decode(&post); err != nil {
+			return nil, nil, err
+		}
+		switch post.LostFound.Kind {
+		case "lost":
+			lost = append(lost, post)
+		case "found":
+			found = append(found, post)
+		}
+	}
+	return lost, found, cursor.Err()
+}
+
+// Records a match in apps.matches, returning false if the pair was
+// already suggested before
+func recordMatch(client *mongo.Client, match Match) (bool, error) {
+	_, err := db.InsertOne(client, "apps", "matches", bson.D{
+		{Key: "lostId", Value: match.Lost.Id},
+		{Key: "foundId", Value: match.Found.Id},
+		{Key: "score", Value: match.Score},
+		{Key: "createdAt", Value: time.Now()},
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Removes the record of a match that could not be sent
+func forgetMatch(client *mongo.Client, match Match) error {
+	_, err := db.DeleteOne(client, "apps", "matches", bson.D{
+		{Key: "lostId", Value: match.Lost.Id},
+		{Key: "foundId", Value: match.Found.Id},
+	})
+	return err
+}
+
+// Posts left out are checked again on the next run
+func withoutPosts(ids []primitive.ObjectID, leave map[primitive.ObjectID]bool) []primitive.ObjectID {
+	var kept []primitive.ObjectID
+	for _, id := range ids {
+		if !leave[id] {
+			kept = append(kept, id)
+		}
+	}
+	return kept
+}
+
+// Each party is sent the other post, unless they opted out of suggestions
+func matchMessages(match Match) []mail.Message {
+	var messages []mail.Message
+	if !match.Lost.LostFound.NoMatches {
+		messages = append(messages, matchMessage(match.Lost, match.Found,
+			fmt.Sprintf("🧭 Someone may have found your %s", match.Lost.Title),
+			"Someone posted on Hoagie Stuff about an item they found that may be the one you lost."))
+	}
+	if !match.Found.LostFound.NoMatches {
+		messages = append(messages, matchMessage(match.Found, match.Lost,
+			fmt.Sprintf("🧭 Someone may be looking for the %s you found", match.Found.Title),
+			"Someone posted on Hoagie Stuff about an item they lost that may be the one you found."))
+	}
+	return messages
+}
+
+func postDetails(info LostFoundInfo) []string {
+	var details []string
+	if location, ok := config.CampusLocations[info.Location]; ok {
+		details = append(details, "Where: "+location)
+	}
+	date := info.Date
+	if est, err := time.LoadLocation("America/New_York"); err == nil {
+		date = date.In(est)
+	}
+	details = append(details, "When: "+date.Format("Mon, Jan 2"))
+	if itemType, ok := config.ItemTypes[info.ItemType]; ok {
+		details = append(details, "Item: "+itemType)
+	}
+	return details
+}
+
+func matchMessage(to MatchPost, other MatchPost, subject string, intro string) mail.Message {
+	details := postDetails(other.LostFound)
+	kind := strings.ToUpper(other.LostFound.Kind)
+	// Private posts are only reachable through the contact relay
+	contact := fmt.Sprintf("%s (%s)", other.User.Name, other.Email)
+	email := html.EscapeString(other.Email)
+	contactHTML := fmt.Sprintf("%s (<a href=\"mailto:%s\">%s</a>)", html.EscapeString(other.User.Name), email, email)
+	reply := "Reply to this email to get in touch, or see"
+	if other.Private {
+		contact = other.User.Name + " (message them on Hoagie Stuff)"
+		contactHTML = html.EscapeString(other.User.Name) + ` (<a target="_blank" href="https://stuff.hoagie.io/lost">message them on Hoagie Stuff</a>)`
+		reply = "See"
+	}
+	optOut := "Don't want match suggestions?"
+
+	var body strings.Builder
+	body.WriteString(`<div style="font-family: sans-serif;">`)
+	body.WriteString(fmt.Sprintf("<p>Hi %s,</p><p>%s</p><hr />", html.EscapeString(to.User.Name), intro))
+	body.WriteString(fmt.Sprintf("<span><b>%s: </b>%s</span><br />", kind, html.EscapeString(other.Title)))
+	body.WriteString(fmt.Sprintf("<div style='margin:5px 0px;'>%s</div>", html.EscapeString(other.Description)))
+	body.WriteString("<span>" + html.EscapeString(strings.Join(details, " · ")) + "</span><br />")
+	body.WriteString(fmt.Sprintf("<span><b>Contact: </b>%s</span><br />", contactHTML))
+	body.WriteString(fmt.Sprintf(`<hr /><p>%s all posts at <a target="_blank" href="https://stuff.hoagie.io/lost">stuff.hoagie.io/lost</a>.</p>`, reply))
+	unsubscribeURL := mail.UnsubscribeURL(to.Email, mail.ListMatches)
+	body.WriteString(fmt.Sprintf(`<p style="font-size:8pt;">%s <a target="_blank" href="%s">Stop all match suggestions</a></p></div>`,
+		optOut, html.EscapeString(unsubscribeURL)))
+
+	text := fmt.Sprintf("Hi %s,\n\n%s\n\n%s: %s\n%s\n%s\nContact: %s\n\n%s\nStop all match suggestions: %s\n",
+		to.User.Name, intro, kind, other.Title, strings.TrimSpace(format.PlainText(other.Description)),
+		strings.Join(details, "\n"), contact, optOut, unsubscribeURL)
+
+	message := mail.Message{
+		To:       to.Email,
+		ToName:   to.User.Name,
+		Subject:  subject,
+		HTML:     body.String(),
+		Text:     text,
+		CustomID: "stuff-match",
+		List:     mail.ListMatches,
+	}
+	if !other.Private {
+		message.ReplyTo = other.Email
+		message.ReplyToName = other.User.Name
+	}
+	return message
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"hoagie-profile/config"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestOpenFilterCoversRenamedCategories(t *testing.T) {
+	taxonomy := config.DefaultTaxonomy()
+	taxonomy.Categories[0].Key = "lost-items"
+	taxonomy.Categories = append(taxonomy.Categories, config.Category{
+		Key: "found-items", Name: "Found", Group: "lost", URL: "https://stuff.hoagie.io/lost", Legacy: true,
+	})
+	if err := taxonomy.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	filter := openFilter(taxonomy, time.Now())
+	categories, ok := filter.Map()["category"].(bson.D)
+	if !ok {
+		t.Fatalf("category filter = %v", filter.Map()["category"])
+	}
+	keys, _ := categories.Map()["$in"].([]string)
+	if len(keys) != 2 || keys[0] != "lost-items" || keys[1] != "found-items" {
+		t.Errorf("categories = %v, want every category of the lost & found group", keys)
+	}
+}
+
+func TestUnsentMatchesAreCheckedAgain(t *testing.T) {
+	a, b, c := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	kept := withoutPosts([]primitive.ObjectID{a, b, c}, map[primitive.ObjectID]bool{b: true})
+	if len(kept) != 2 || kept[0] != a || kept[1] != c {
+		t.Errorf("checked = %v, want %v", kept, []primitive.ObjectID{a, c})
+	}
+}
+
+func TestMatchMessagePointsAtTheUnsubscribeLink(t *testing.T) {
+	to := MatchPost{Email: "a@princeton.edu", LostFound: LostFoundInfo{Kind: "lost"}}
+	other := MatchPost{Email: "b@princeton.edu", Title: "Keys", LostFound: LostFoundInfo{Kind: "found"}}
+	message := matchMessage(to, other, "subject", "intro")
+	if strings.Contains(message.Text, "Edit it") || !strings.Contains(message.Text, "Stop all match suggestions: ") {
+		t.Errorf("text = %q, want the opt-out to point at the unsubscribe link", message.Text)
+	}
+}
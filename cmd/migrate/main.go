@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"hoagie-profile/db"
+
+	"github.com/joho/godotenv"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const usage = `Usage: go run cmd/migrate/main.go [flags] [command]
+
+Commands:
+  up       apply pending migrations, then sync indexes (default)
+  down     revert the most recent migrations
+  status   list migrations and whether they have been applied
+  indexes  only sync indexes
+
+Flags:
+`
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "only print the changes that would be made")
+	target := flag.Int("to", 0, "with up, stop after this migration version")
+	steps := flag.Int("steps", 1, "with down, the number of migrations to revert")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	command := flag.Arg(0)
+	if command == "" {
+		command = "up"
+	}
+
+	godotenv.Load(".env.local")
+	client, err := db.MongoClient()
+	if err != nil {
+		panic("Database connection error " + err.Error())
+	}
+	ctx := context.Background()
+	defer client.Disconnect(ctx)
+
+	switch command {
+	case "up":
+		runUp(client, *target, *dryRun)
+		runIndexes(client, *dryRun)
+	case "down":
+		runDown(client, *steps, *dryRun)
+	case "status":
+		runStatus(client)
+	case "indexes":
+		runIndexes(client, *dryRun)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func runUp(client *mongo.Client, target int, dryRun bool) {
+	migrations, err := db.MigrateUp(client, "apps", db.AppsMigrations, target, dryRun)
+	for _, migration := range migrations {
+		if dryRun {
+			fmt.Printf("Would apply migration %s\n", migration)
+		} else {
+			fmt.Printf("Applied migration %s\n", migration)
+		}
+	}
+	if err != nil {
+		panic("Error applying migrations " + err.Error())
+	}
+	if len(migrations) == 0 {
+		fmt.Println("Migrations are up to date")
+	}
+}
+
+func runDown(client *mongo.Client, steps int, dryRun bool) {
+	migrations, err := db.MigrateDown(client, "apps", db.AppsMigrations, steps, dryRun)
+	for _, migration := range migrations {
+		if dryRun {
+			fmt.Printf("Would revert migration %s\n", migration)
+		} else {
+			fmt.Printf("Reverted migration %s\n", migration)
+		}
+	}
+	if err != nil {
+		panic("Error reverting migrations " + err.Error())
+	}
+	if len(migrations) == 0 {
+		fmt.Println("No migrations to revert")
+	}
+}
+
+func runStatus(client *mongo.Client) {
+	applied, err := db.AppliedMigrations(client, "apps")
+	if err != nil {
+		panic("Error getting applied migrations " + err.Error())
+	}
+	migrations := append([]db.Migration{}, db.AppsMigrations...)
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	for _, migration := range migrations {
+		if record, ok := applied[migration.Version]; ok {
+			fmt.Printf("[x] %s (applied %s)\n", migration, record.AppliedAt.Format("2006-01-02 15:04"))
+		} else {
+			fmt.Printf("[ ] %s\n", migration)
+		}
+	}
+}
+
+// Bring the indexes of the apps database in line with db.AppsIndexes,
+// the same step the server runs on startup
+func runIndexes(client *mongo.Client, dryRun bool) {
+	changes, err := db.SyncIndexes(client, "apps", db.AppsIndexes, dryRun)
+	for _, change := range changes {
+		if dryRun {
+			fmt.Printf("Would %s\n", change)
+		} else {
+			fmt.Printf("Applied %s\n", change)
+		}
+	}
+	if err != nil {
+		panic("Error syncing indexes " + err.Error())
+	}
+	if len(changes) == 0 {
+		fmt.Println("Indexes are up to date")
+	}
+}
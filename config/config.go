@@ -0,0 +1,43 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var REQUEST_TIMEOUT = 5 * time.Second
+
+// Configuration documents live in apps.config, keyed by their name
+const (
+	configDatabase   = "apps"
+	configCollection = "config"
+)
+
+// Load the configuration document with the given name into result.
+// If the document does not exist, result is left untouched so that
+// callers can pass in a value that already holds the defaults.
+// NOTE: Make sure to pass a pointer instead of a value for the result
+func Load(client *mongo.Client, name string, result interface{}) error {
+	coll := client.Database(configDatabase).Collection(configCollection)
+	ctx, cancel := context.WithTimeout(context.Background(), REQUEST_TIMEOUT)
+	defer cancel()
+	err := coll.FindOne(ctx, bson.D{{Key: "_id", Value: name}}).Decode(result)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	}
+	return err
+}
+
+// Save the configuration document with the given name, replacing any existing one
+func Save(client *mongo.Client, name string, value interface{}) error {
+	coll := client.Database(configDatabase).Collection(configCollection)
+	ctx, cancel := context.WithTimeout(context.Background(), REQUEST_TIMEOUT)
+	defer cancel()
+	_, err := coll.ReplaceOne(ctx, bson.D{{Key: "_id", Value: name}}, value, options.Replace().SetUpsert(true))
+	return err
+}
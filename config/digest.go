@@ -0,0 +1,227 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const digestConfigName = "digest"
+
+// Layout of the dates of summer ranges
+const DateLayout = "2006-01-02"
+
+// Keys of the digest sections, in their default order
+var DigestSections = []string{"lost", "sale", "bulletin"}
+
+// Orders of the posts within a digest section
+const (
+	// Oldest first
+	OrderCreated = "created"
+	// Posts with a priority tag first, then oldest first
+	OrderPriority = "priority"
+)
+
+// When the Hoagie Stuff digest is sent and what it says
+type Digest struct {
+	// Weekdays, such as "tuesday", on which the digest is sent however few posts there are
+	Days []string `bson:"days" json:"days"`
+	// With at least this many posts, the digest is sent on any day, even in summer
+	MinPosts int `bson:"minPosts" json:"minPosts"`
+	// Date ranges in which the digest is only sent once it reaches MinPosts
+	Summer []DateRange `bson:"summer" json:"summer"`
+	// HTML shown at the top of the digest, outside of and during summer
+	Intro       string `bson:"intro" json:"intro"`
+	SummerIntro string `bson:"summerIntro" json:"summerIntro"`
+	// Keys of the sections in the order they appear, every section once.
+	// Empty for the default order.
+	SectionOrder []string `bson:"sectionOrder" json:"sectionOrder"`
+	// OrderCreated or OrderPriority
+	PostOrder string `bson:"postOrder" json:"postOrder"`
+	// Tags that put a post first in its section with OrderPriority
+	PriorityTags []string `bson:"priorityTags" json:"priorityTags"`
+}
+
+// Inclusive range of dates in Eastern Time, formatted with DateLayout
+type DateRange struct {
+	Start string `bson:"start" json:"start"`
+	End   string `bson:"end" json:"end"`
+}
+
+func DefaultDigest() Digest {
+	return Digest{
+		Days:     []string{"tuesday", "thursday", "saturday"},
+		MinPosts: 5,
+		Summer:   []DateRange{},
+		Intro: `<p><br />Here is a weekly digest of posts made to <a href="https://stuff.hoagie.io/">Hoagie Stuff</a>,
+	from Sales to Lost & Found and more, sent every Tuesday, Thursday, and Saturday.</p>`,
+		SummerIntro:  `<p><br />Here is a digest of posts made to <a href="https://stuff.hoagie.io/">Hoagie Stuff</a> over the past few days. It's Summer, so Hoagie is taking things slow.</p>`,
+		SectionOrder: DigestSections,
+		PostOrder:    OrderCreated,
+		PriorityTags: []string{"announcement", "opportunity"},
+	}
+}
+
+// Load the digest configuration, falling back to the defaults
+func LoadDigest(client *mongo.Client) (Digest, error) {
+	digest := DefaultDigest()
+	err := Load(client, digestConfigName, &digest)
+	return digest, err
+}
+
+// Save the digest configuration after validating it
+func SaveDigest(client *mongo.Client, digest Digest) error {
+	if err := digest.Validate(); err != nil {
+		return err
+	}
+	return Save(client, digestConfigName, digest)
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+func eastern() *time.Location {
+	if est, err := time.LoadLocation("America/New_York"); err == nil {
+		return est
+	}
+	return time.UTC
+}
+
+func (r DateRange) bounds() (time.Time, time.Time, error) {
+	start, err := time.ParseInLocation(DateLayout, r.Start, eastern())
+	if err != nil {
+		return start, start, fmt.Errorf("invalid start date: %s", r.Start)
+	}
+	end, err := time.ParseInLocation(DateLayout, r.End, eastern())
+	if err != nil {
+		return start, end, fmt.Errorf("invalid end date: %s", r.End)
+	}
+	return start, end, nil
+}
+
+// Returns whether the given time falls on one of the days of the range
+func (r DateRange) Contains(t time.Time) bool {
+	start, end, err := r.bounds()
+	if err != nil {
+		return false
+	}
+	return !t.Before(start) && t.Before(end.AddDate(0, 0, 1))
+}
+
+// Returns an error describing the first invalid setting, if any
+func (d Digest) Validate() error {
+	if len(d.Days) == 0 {
+		return fmt.Errorf("at least one digest day is required")
+	}
+	for _, day := range d.Days {
+		if _, ok := weekdays[strings.ToLower(day)]; !ok {
+			return fmt.Errorf("invalid digest day: %s", day)
+		}
+	}
+	if d.MinPosts < 1 {
+		return fmt.Errorf("minimum number of posts needs to be at least 1")
+	}
+	for _, summer := range d.Summer {
+		start, end, err := summer.bounds()
+		if err != nil {
+			return err
+		}
+		if end.Before(start) {
+			return fmt.Errorf("summer range ends before it starts: %s to %s", summer.Start, summer.End)
+		}
+	}
+	if strings.TrimSpace(d.Intro) == "" || strings.TrimSpace(d.SummerIntro) == "" {
+		return fmt.Errorf("intro and summer intro are required")
+	}
+	if len(d.SectionOrder) > 0 {
+		if len(d.SectionOrder) != len(DigestSections) {
+			return fmt.Errorf("section order needs every section once: %s", strings.Join(DigestSections, ", "))
+		}
+		seen := map[string]bool{}
+		for _, key := range d.SectionOrder {
+			if seen[key] || !isDigestSection(key) {
+				return fmt.Errorf("section order needs every section once: %s", strings.Join(DigestSections, ", "))
+			}
+			seen[key] = true
+		}
+	}
+	if d.PostOrder != "" && d.PostOrder != OrderCreated && d.PostOrder != OrderPriority {
+		return fmt.Errorf("invalid post order: %s", d.PostOrder)
+	}
+	return nil
+}
+
+func isDigestSection(key string) bool {
+	for _, section := range DigestSections {
+		if section == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the keys of the sections in the order they appear
+func (d Digest) Sections() []string {
+	if len(d.SectionOrder) == 0 {
+		return DigestSections
+	}
+	return d.SectionOrder
+}
+
+// Returns whether a post with the given tags is put first with OrderPriority
+func (d Digest) IsPriority(tags []string) bool {
+	for _, tag := range tags {
+		for _, priority := range d.PriorityTags {
+			if strings.EqualFold(tag, priority) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns whether the given time is in one of the summer ranges
+func (d Digest) IsSummer(t time.Time) bool {
+	for _, summer := range d.Summer {
+		if summer.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns whether the given time is on a digest day outside of summer
+func (d Digest) IsDigestDay(t time.Time) bool {
+	if d.IsSummer(t) {
+		return false
+	}
+	weekday := t.In(eastern()).Weekday()
+	for _, day := range d.Days {
+		if weekdays[strings.ToLower(day)] == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns whether a digest with the given number of posts should be sent at the given time
+func (d Digest) ShouldSend(posts int, t time.Time) bool {
+	return posts > 0 && (posts >= d.MinPosts || d.IsDigestDay(t))
+}
+
+// Returns the intro of a digest sent at the given time
+func (d Digest) IntroFor(t time.Time) string {
+	if d.IsSummer(t) {
+		return d.SummerIntro
+	}
+	return d.Intro
+}
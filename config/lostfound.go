@@ -0,0 +1,41 @@
+package config
+
+// Campus locations a lost & found post can refer to, by key
+var CampusLocations = map[string]string{
+	"butler":    "Butler College",
+	"forbes":    "Forbes College",
+	"mathey":    "Mathey College",
+	"ncw":       "New College West",
+	"rocky":     "Rockefeller College",
+	"whitman":   "Whitman College",
+	"yeh":       "Yeh College",
+	"grad":      "Graduate College",
+	"firestone": "Firestone Library",
+	"lewis":     "Lewis Library",
+	"frist":     "Frist Campus Center",
+	"dillon":    "Dillon Gym",
+	"friend":    "Friend Center",
+	"e-quad":    "Engineering Quad",
+	"mccosh":    "McCosh Hall",
+	"robertson": "Robertson Hall",
+	"chapel":    "University Chapel",
+	"street":    "Prospect Avenue",
+	"nassau":    "Nassau Street",
+	"transit":   "TigerTransit / Dinky",
+	"other":     "Other",
+}
+
+// Kinds of items a lost & found post can be about, by key
+var ItemTypes = map[string]string{
+	"electronics": "Electronics",
+	"phone":       "Phone",
+	"keys":        "Keys",
+	"wallet":      "Wallet",
+	"id":          "ID / Prox",
+	"bag":         "Bag",
+	"clothing":    "Clothing",
+	"jewelry":     "Jewelry & Watches",
+	"bottle":      "Water Bottle",
+	"books":       "Books & Notes",
+	"other":       "Other",
+}
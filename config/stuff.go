@@ -0,0 +1,88 @@
+package config
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const stuffConfigName = "stuff"
+
+// Posts created before per-post expiration was added have no expiresAt
+// and expire this long after they were created
+const LegacyExpiration = 10 * 24 * time.Hour
+
+// Filter condition for Stuff posts that have not expired at the given time
+func UnexpiredFilter(now time.Time) bson.E {
+	return bson.E{Key: "$or", Value: bson.A{
+		bson.D{{Key: "expiresAt", Value: bson.D{{Key: "$gt", Value: now}}}},
+		bson.D{
+			{Key: "expiresAt", Value: bson.D{{Key: "$exists", Value: false}}},
+			{Key: "createdAt", Value: bson.D{{Key: "$gt", Value: now.Add(-LegacyExpiration)}}},
+		},
+	}}
+}
+
+// Settings for Hoagie Stuff posts
+type Stuff struct {
+	// Maximum number of posts a user can have at once in each category.
+	// Marketplace covers both the "sale" and "selling" categories.
+	Quota map[string]int `bson:"quota" json:"quota"`
+	// How long posts stay up in each category group, chosen by the user within bounds
+	Expiration map[string]Expiration `bson:"expiration" json:"expiration"`
+	// Number of reports after which a post is hidden until a moderator reviews it
+	ReportThreshold int `bson:"reportThreshold" json:"reportThreshold"`
+}
+
+// Quota used for categories that are missing from the configuration
+const defaultQuota = 1
+
+func DefaultStuff() Stuff {
+	return Stuff{
+		Quota: map[string]int{
+			"marketplace": 3,
+			"lost":        3,
+			"bulletin":    2,
+		},
+		Expiration: map[string]Expiration{
+			"marketplace": {MinDays: 3, MaxDays: 30, DefaultDays: 14},
+			"lost":        {MinDays: 3, MaxDays: 60, DefaultDays: 30},
+			"bulletin":    {MinDays: 1, MaxDays: 30, DefaultDays: 10},
+		},
+		ReportThreshold: 3,
+	}
+}
+
+// Load the Stuff configuration, falling back to the defaults
+func LoadStuff(client *mongo.Client) (Stuff, error) {
+	stuff := DefaultStuff()
+	err := Load(client, stuffConfigName, &stuff)
+	return stuff, err
+}
+
+// Returns the number of posts a user may have at once in the given category group
+func (s Stuff) QuotaFor(category string) int {
+	if quota, ok := s.Quota[category]; ok {
+		return quota
+	}
+	return defaultQuota
+}
+
+// Bounds on how long a post in a category group stays up, in days
+type Expiration struct {
+	MinDays     int `bson:"minDays" json:"minDays"`
+	MaxDays     int `bson:"maxDays" json:"maxDays"`
+	DefaultDays int `bson:"defaultDays" json:"defaultDays"`
+}
+
+// Expiration used for categories that are missing from the configuration
+var defaultExpiration = Expiration{MinDays: 1, MaxDays: 10, DefaultDays: 10}
+
+// Returns the expiration bounds of the given category group
+func (s Stuff) ExpirationFor(category string) Expiration {
+	if expiration, ok := s.Expiration[category]; ok {
+		return expiration
+	}
+	return defaultExpiration
+}
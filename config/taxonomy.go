@@ -0,0 +1,204 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const taxonomyConfigName = "taxonomy"
+
+// Categories of Hoagie Stuff posts and the tags allowed in each
+type Taxonomy struct {
+	Categories []Category `bson:"categories" json:"categories"`
+}
+
+type Category struct {
+	Key   string `bson:"key" json:"key"`
+	Name  string `bson:"name" json:"name"`
+	Emoji string `bson:"emoji" json:"emoji"`
+	// Categories of a group share quotas and expirations, are filtered
+	// together and make up one digest section, such as the Marketplace
+	Group string `bson:"group" json:"group"`
+	// Where the group can be seen on Hoagie Stuff
+	URL string `bson:"url" json:"url"`
+	// Older categories are still accepted but not offered for new posts
+	Legacy bool  `bson:"legacy" json:"legacy"`
+	Tags   []Tag `bson:"tags" json:"tags"`
+}
+
+type Tag struct {
+	Key  string `bson:"key" json:"key"`
+	Name string `bson:"name" json:"name"`
+}
+
+var marketplaceTags = []Tag{
+	{Key: "accessories", Name: "Accessories"},
+	{Key: "clothing", Name: "Clothing"},
+	{Key: "tech", Name: "Tech"},
+	{Key: "furniture", Name: "Furniture"},
+	{Key: "school", Name: "School"},
+	{Key: "tickets", Name: "Tickets"},
+	{Key: "other", Name: "Other"},
+}
+
+func DefaultTaxonomy() Taxonomy {
+	return Taxonomy{
+		Categories: []Category{
+			{
+				Key: "lost", Name: "Lost & Found", Emoji: "🧭", Group: "lost", URL: "https://stuff.hoagie.io/lost",
+				Tags: []Tag{{Key: "lost", Name: "Lost"}, {Key: "found", Name: "Found"}},
+			},
+			{Key: "sale", Name: "Marketplace", Emoji: "🛍️", Group: "marketplace", URL: "https://stuff.hoagie.io/marketplace", Tags: marketplaceTags},
+			{Key: "selling", Name: "Marketplace", Emoji: "🛍️", Group: "marketplace", URL: "https://stuff.hoagie.io/marketplace", Legacy: true, Tags: marketplaceTags},
+			{Key: "marketplace", Name: "Marketplace", Emoji: "🛍️", Group: "marketplace", URL: "https://stuff.hoagie.io/marketplace", Legacy: true, Tags: marketplaceTags},
+			{
+				Key: "bulletin", Name: "Bulletins", Emoji: "✉️", Group: "bulletin", URL: "https://stuff.hoagie.io/bulletins",
+				Tags: []Tag{{Key: "announcement", Name: "Announcement"}, {Key: "request", Name: "Request"}, {Key: "opportunity", Name: "Opportunity"}},
+			},
+		},
+	}
+}
+
+// Load the taxonomy, falling back to the defaults
+func LoadTaxonomy(client *mongo.Client) (Taxonomy, error) {
+	taxonomy := DefaultTaxonomy()
+	err := Load(client, taxonomyConfigName, &taxonomy)
+	return taxonomy, err
+}
+
+// Save the taxonomy after validating it
+func SaveTaxonomy(client *mongo.Client, taxonomy Taxonomy) error {
+	if err := taxonomy.Validate(); err != nil {
+		return err
+	}
+	return Save(client, taxonomyConfigName, taxonomy)
+}
+
+// Keys of categories, groups and tags, as stored in posts
+var taxonomyKey = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+// Returns an error describing the first invalid category or tag, if any
+func (t Taxonomy) Validate() error {
+	if len(t.Categories) == 0 {
+		return fmt.Errorf("at least one category is required")
+	}
+	seen := map[string]bool{}
+	for _, category := range t.Categories {
+		if !taxonomyKey.MatchString(category.Key) || !taxonomyKey.MatchString(category.Group) {
+			return fmt.Errorf("category and group keys need lowercase letters, digits and dashes: %s", category.Key)
+		}
+		if seen[category.Key] {
+			return fmt.Errorf("duplicate category: %s", category.Key)
+		}
+		seen[category.Key] = true
+		if strings.TrimSpace(category.Name) == "" {
+			return fmt.Errorf("category %s needs a name", category.Key)
+		}
+		seenTags := map[string]bool{}
+		for _, tag := range category.Tags {
+			if !taxonomyKey.MatchString(tag.Key) {
+				return fmt.Errorf("tag keys need lowercase letters, digits and dashes: %s", tag.Key)
+			}
+			if seenTags[tag.Key] {
+				return fmt.Errorf("duplicate tag %s in category %s", tag.Key, category.Key)
+			}
+			seenTags[tag.Key] = true
+			if strings.TrimSpace(tag.Name) == "" {
+				return fmt.Errorf("tag %s needs a name", tag.Key)
+			}
+		}
+	}
+	for _, category := range t.Categories {
+		if _, ok := t.Section(category.Key); !ok {
+			return fmt.Errorf("group %s needs a category that is not legacy", category.Group)
+		}
+	}
+	return nil
+}
+
+// Returns the category with the given key
+func (t Taxonomy) Category(key string) (Category, bool) {
+	for _, category := range t.Categories {
+		if category.Key == key {
+			return category, true
+		}
+	}
+	return Category{}, false
+}
+
+// Returns whether the key is one of the categories
+func (t Taxonomy) IsCategory(key string) bool {
+	_, ok := t.Category(key)
+	return ok
+}
+
+// Returns the group of the given category, or "" if it is unknown
+func (t Taxonomy) Group(key string) string {
+	category, _ := t.Category(key)
+	return category.Group
+}
+
+// Returns the keys of every category in the given group
+func (t Taxonomy) GroupCategories(group string) []string {
+	var keys []string
+	for _, category := range t.Categories {
+		if category.Group == group {
+			keys = append(keys, category.Key)
+		}
+	}
+	return keys
+}
+
+// Returns the first category of the group of the given category that is
+// not legacy. Its key, name and emoji stand for the whole group, such as
+// in the digest sections.
+func (t Taxonomy) Section(key string) (Category, bool) {
+	group := t.Group(key)
+	for _, category := range t.Categories {
+		if group != "" && category.Group == group && !category.Legacy {
+			return category, true
+		}
+	}
+	return Category{}, false
+}
+
+// Returns the category standing for each group, in order
+func (t Taxonomy) Sections() []Category {
+	var sections []Category
+	for _, category := range t.Categories {
+		if section, ok := t.Section(category.Key); ok && section.Key == category.Key {
+			sections = append(sections, section)
+		}
+	}
+	return sections
+}
+
+// Returns whether the key is the section of a group
+func (t Taxonomy) IsSection(key string) bool {
+	section, ok := t.Section(key)
+	return ok && section.Key == key
+}
+
+// Returns whether posts of the given category can use the tag
+func (t Taxonomy) AllowsTag(key string, tag string) bool {
+	category, _ := t.Category(key)
+	for _, allowed := range category.Tags {
+		if allowed.Key == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns whether the tag is allowed in any category
+func (t Taxonomy) IsTag(tag string) bool {
+	for _, category := range t.Categories {
+		if t.AllowsTag(category.Key, tag) {
+			return true
+		}
+	}
+	return false
+}
@@ -63,6 +63,23 @@ func FindMany(
 	return result, nil
 }
 
+// Count the documents in a collection that match a filter
+func CountDocuments(
+	client *mongo.Client,
+	databaseName string,
+	collectionName string,
+	filter bson.D,
+) (int64, error) {
+	coll := client.Database(databaseName).Collection(collectionName)
+	ctx, cancel := context.WithTimeout(context.Background(), REQUEST_TIMEOUT)
+	defer cancel()
+	count, err := coll.CountDocuments(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
 // Update many documents in a collection
 func UpdateMany(
 	client *mongo.Client,
@@ -119,6 +136,24 @@ func UpdateOne(
 	return result, nil
 }
 
+// Update one document in a collection, inserting it if none matches
+func UpsertOne(
+	client *mongo.Client,
+	databaseName string,
+	collectionName string,
+	filter bson.D,
+	updateOperation bson.D,
+) (*mongo.UpdateResult, error) {
+	coll := client.Database(databaseName).Collection(collectionName)
+	ctx, cancel := context.WithTimeout(context.Background(), REQUEST_TIMEOUT)
+	defer cancel()
+	result, err := coll.UpdateOne(ctx, filter, updateOperation, options.Update().SetUpsert(true))
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 // Delete one existing document in a collection
 func DeleteOne(
 	client *mongo.Client,
@@ -0,0 +1,279 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// An index that should exist on a collection. Indexes are matched
+// against the existing ones by name, so every index needs one.
+type Index struct {
+	Collection         string
+	Name               string
+	Keys               bson.D
+	Unique             bool
+	ExpireAfterSeconds *int32
+	// Weights of the fields of a text index, fields default to 1
+	Weights map[string]int32
+}
+
+// What SyncIndexes did, or would do, to an index
+type IndexChange struct {
+	Collection string
+	Name       string
+	// "create" for missing indexes, "update" for indexes whose definition changed
+	Action string
+}
+
+func (change IndexChange) String() string {
+	return fmt.Sprintf("%s %s.%s", change.Action, change.Collection, change.Name)
+}
+
+// Indexes of the apps database
+var AppsIndexes = []Index{
+	// Stuff feed ordering and expiration, see handlers/lifecycle.go
+	{Collection: "stuff", Name: "createdAt_1", Keys: bson.D{{Key: "createdAt", Value: 1}}},
+	{Collection: "stuff", Name: "expiresAt_1", Keys: bson.D{{Key: "expiresAt", Value: 1}}},
+	{Collection: "stuff", Name: "email_1", Keys: bson.D{{Key: "email", Value: 1}}},
+	{Collection: "stuff", Name: "marketplace.price_1", Keys: bson.D{{Key: "marketplace.price", Value: 1}}},
+	// Images are deleted with the posts that use them, or when no post uses
+	// them, see handlers/images.go
+	{Collection: "stuff", Name: "thumbnail_1", Keys: bson.D{{Key: "thumbnail", Value: 1}}},
+	{Collection: "images", Name: "email_1", Keys: bson.D{{Key: "email", Value: 1}}},
+	{Collection: "images", Name: "createdAt_1", Keys: bson.D{{Key: "createdAt", Value: 1}}},
+	// Full-text search over posts, weighing titles and tags over descriptions
+	{
+		Collection: "stuff",
+		Name:       "stuff_text",
+		Keys: bson.D{
+			{Key: "title", Value: "text"},
+			{Key: "description", Value: "text"},
+			{Key: "tags", Value: "text"},
+		},
+		Weights: map[string]int32{"title": 10, "tags": 5, "description": 1},
+	},
+	// Users can report each post once, see handlers/moderation.go
+	{
+		Collection: "reports",
+		Name:       "postId_1_email_1",
+		Keys:       bson.D{{Key: "postId", Value: 1}, {Key: "email", Value: 1}},
+		Unique:     true,
+	},
+	// Unfinished digest runs are looked up before every run, see digest.Reconcile,
+	// and the archive lists sent digests by date
+	{
+		Collection: "digests",
+		Name:       "status_1_sentAt_-1",
+		Keys:       bson.D{{Key: "status", Value: 1}, {Key: "sentAt", Value: -1}},
+	},
+	// Active announcements are pinned to every digest, see digest.ActiveAnnouncements
+	{Collection: "announcements", Name: "endsAt_1", Keys: bson.D{{Key: "endsAt", Value: 1}}},
+	// Every user has at most one digest subscription
+	{Collection: "subscriptions", Name: "email_1", Keys: bson.D{{Key: "email", Value: 1}}, Unique: true},
+	{Collection: "preferences", Name: "email_1", Keys: bson.D{{Key: "email", Value: 1}}, Unique: true},
+	{Collection: "searches", Name: "email_1", Keys: bson.D{{Key: "email", Value: 1}}},
+	{Collection: "mail", Name: "email_1_schedule_1", Keys: bson.D{{Key: "email", Value: 1}, {Key: "schedule", Value: 1}}},
+	{Collection: "sent", Name: "email_1_createdAt_-1", Keys: bson.D{{Key: "email", Value: 1}, {Key: "createdAt", Value: -1}}},
+	{Collection: "sent", Name: "messageIds_1", Keys: bson.D{{Key: "messageIds", Value: 1}}},
+	// Every lost & found pair is only suggested once, see cmd/match
+	{
+		Collection: "matches",
+		Name:       "lostId_1_foundId_1",
+		Keys:       bson.D{{Key: "lostId", Value: 1}, {Key: "foundId", Value: 1}},
+		Unique:     true,
+	},
+	// Mailjet events are stored once, see handlers/events.go
+	{
+		Collection: "mail_events",
+		Name:       "messageId_1_event_1_time_1",
+		Keys:       bson.D{{Key: "messageId", Value: 1}, {Key: "event", Value: 1}, {Key: "time", Value: 1}},
+		Unique:     true,
+	},
+	// Events that are not counted yet are retried, see handlers/events.go
+	{
+		Collection: "mail_events",
+		Name:       "counted_1_createdAt_1",
+		Keys:       bson.D{{Key: "counted", Value: 1}, {Key: "createdAt", Value: 1}},
+	},
+}
+
+// Index definition as reported by listIndexes
+type existingIndex struct {
+	Name               string      `bson:"name"`
+	Key                bson.D      `bson:"key"`
+	Unique             bool        `bson:"unique"`
+	ExpireAfterSeconds interface{} `bson:"expireAfterSeconds"`
+	Weights            bson.M      `bson:"weights"`
+}
+
+func (index Index) model() mongo.IndexModel {
+	indexOptions := options.Index().SetName(index.Name)
+	if index.Unique {
+		indexOptions.SetUnique(true)
+	}
+	if index.ExpireAfterSeconds != nil {
+		indexOptions.SetExpireAfterSeconds(*index.ExpireAfterSeconds)
+	}
+	if len(index.Weights) > 0 {
+		weights := bson.D{}
+		for field, weight := range index.Weights {
+			weights = append(weights, bson.E{Key: field, Value: weight})
+		}
+		indexOptions.SetWeights(weights)
+	}
+	return mongo.IndexModel{Keys: index.Keys, Options: indexOptions}
+}
+
+// Numbers come back from the server as int32, int64 or double
+// depending on how the index was created, so compare them as floats
+func normalizeIndexValue(value interface{}) interface{} {
+	switch number := value.(type) {
+	case int:
+		return float64(number)
+	case int32:
+		return float64(number)
+	case int64:
+		return float64(number)
+	case float64:
+		return number
+	}
+	return value
+}
+
+// Returns the key and text weights of an index in the form listIndexes reports
+// them, where the fields of a text index are replaced by _fts and _ftsx
+func (index Index) normalized() ([]string, map[string]interface{}) {
+	var keys []string
+	var weights map[string]interface{}
+	for _, key := range index.Keys {
+		if key.Value != "text" {
+			keys = append(keys, fmt.Sprintf("%s:%v", key.Key, normalizeIndexValue(key.Value)))
+			continue
+		}
+		if weights == nil {
+			weights = map[string]interface{}{}
+			keys = append(keys, "_fts:text", fmt.Sprintf("_ftsx:%v", normalizeIndexValue(1)))
+		}
+		weight, ok := index.Weights[key.Key]
+		if !ok {
+			weight = 1
+		}
+		weights[key.Key] = normalizeIndexValue(weight)
+	}
+	return keys, weights
+}
+
+func (index Index) matches(existing existingIndex) bool {
+	keys, weights := index.normalized()
+	var existingKeys []string
+	for _, key := range existing.Key {
+		existingKeys = append(existingKeys, fmt.Sprintf("%s:%v", key.Key, normalizeIndexValue(key.Value)))
+	}
+	if !reflect.DeepEqual(keys, existingKeys) || index.Unique != existing.Unique {
+		return false
+	}
+
+	var expireAfterSeconds interface{}
+	if index.ExpireAfterSeconds != nil {
+		expireAfterSeconds = normalizeIndexValue(*index.ExpireAfterSeconds)
+	}
+	if expireAfterSeconds != normalizeIndexValue(existing.ExpireAfterSeconds) {
+		return false
+	}
+
+	var existingWeights map[string]interface{}
+	if existing.Weights != nil {
+		existingWeights = map[string]interface{}{}
+		for field, weight := range existing.Weights {
+			existingWeights[field] = normalizeIndexValue(weight)
+		}
+	}
+	return reflect.DeepEqual(weights, existingWeights)
+}
+
+func listIndexes(coll *mongo.Collection) (map[string]existingIndex, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), REQUEST_TIMEOUT)
+	defer cancel()
+
+	existing := map[string]existingIndex{}
+	cursor, err := coll.Indexes().List(ctx)
+	if err != nil {
+		// Collections that do not exist yet have no indexes
+		if cmdErr, ok := err.(mongo.CommandError); ok && cmdErr.Name == "NamespaceNotFound" {
+			return existing, nil
+		}
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var index existingIndex
+		if err := cursor.Decode(&index); err != nil {
+			return nil, err
+		}
+		existing[index.Name] = index
+	}
+	return existing, cursor.Err()
+}
+
+// Bring the indexes of a database in line with the given definitions.
+// Missing indexes are created and indexes whose definition changed are
+// dropped and recreated. Indexes that are not declared, such as ones added
+// by hand, are left alone, so running this again is a no-op. With dryRun,
+// the changes are only reported.
+func SyncIndexes(
+	client *mongo.Client,
+	databaseName string,
+	indexes []Index,
+	dryRun bool,
+) ([]IndexChange, error) {
+	var changes []IndexChange
+	database := client.Database(databaseName)
+	existingByCollection := map[string]map[string]existingIndex{}
+
+	for _, index := range indexes {
+		coll := database.Collection(index.Collection)
+		existing, ok := existingByCollection[index.Collection]
+		if !ok {
+			var err error
+			existing, err = listIndexes(coll)
+			if err != nil {
+				return changes, fmt.Errorf("error listing indexes of %s: %s", index.Collection, err)
+			}
+			existingByCollection[index.Collection] = existing
+		}
+
+		change := IndexChange{Collection: index.Collection, Name: index.Name, Action: "create"}
+		if current, ok := existing[index.Name]; ok {
+			if index.matches(current) {
+				continue
+			}
+			change.Action = "update"
+		}
+		changes = append(changes, change)
+		if dryRun {
+			continue
+		}
+		if err := applyIndexChange(coll, index, change); err != nil {
+			return changes, fmt.Errorf("error applying %s: %s", change, err)
+		}
+	}
+	return changes, nil
+}
+
+func applyIndexChange(coll *mongo.Collection, index Index, change IndexChange) error {
+	ctx, cancel := context.WithTimeout(context.Background(), REQUEST_TIMEOUT)
+	defer cancel()
+	if change.Action == "update" {
+		if _, err := coll.Indexes().DropOne(ctx, index.Name); err != nil {
+			return err
+		}
+	}
+	_, err := coll.Indexes().CreateOne(ctx, index.model())
+	return err
+}
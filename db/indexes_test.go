@@ -0,0 +1,157 @@
+package db
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestNormalizeIndexValue(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  interface{}
+	}{
+		{1, float64(1)},
+		{int32(-1), float64(-1)},
+		{int64(3600), float64(3600)},
+		{float64(1), float64(1)},
+		{"text", "text"},
+		{nil, nil},
+	}
+	for _, test := range tests {
+		if got := normalizeIndexValue(test.value); got != test.want {
+			t.Errorf("normalizeIndexValue(%#v) = %#v, want %#v", test.value, got, test.want)
+		}
+	}
+}
+
+func TestIndexMatches(t *testing.T) {
+	ttl := int32(3600)
+	compound := Index{
+		Collection: "reports",
+		Name:       "postId_1_email_1",
+		Keys:       bson.D{{Key: "postId", Value: 1}, {Key: "email", Value: 1}},
+		Unique:     true,
+	}
+	expiring := Index{
+		Collection:         "sessions",
+		Name:               "createdAt_1",
+		Keys:               bson.D{{Key: "createdAt", Value: 1}},
+		ExpireAfterSeconds: &ttl,
+	}
+	text := Index{
+		Collection: "stuff",
+		Name:       "stuff_text",
+		Keys:       bson.D{{Key: "title", Value: "text"}, {Key: "description", Value: "text"}},
+		Weights:    map[string]int32{"title": 10},
+	}
+	// How listIndexes reports the text index, with the default weight of description
+	existingText := existingIndex{
+		Name:    "stuff_text",
+		Key:     bson.D{{Key: "_fts", Value: "text"}, {Key: "_ftsx", Value: int32(1)}},
+		Weights: bson.M{"title": int32(10), "description": int32(1)},
+	}
+
+	tests := []struct {
+		name     string
+		index    Index
+		existing existingIndex
+		want     bool
+	}{
+		{
+			name:     "same keys reported as int32",
+			index:    compound,
+			existing: existingIndex{Key: bson.D{{Key: "postId", Value: int32(1)}, {Key: "email", Value: int32(1)}}, Unique: true},
+			want:     true,
+		},
+		{
+			name:     "same keys reported as double",
+			index:    compound,
+			existing: existingIndex{Key: bson.D{{Key: "postId", Value: 1.0}, {Key: "email", Value: 1.0}}, Unique: true},
+			want:     true,
+		},
+		{
+			name:     "keys in another order",
+			index:    compound,
+			existing: existingIndex{Key: bson.D{{Key: "email", Value: 1}, {Key: "postId", Value: 1}}, Unique: true},
+			want:     false,
+		},
+		{
+			name:     "descending key",
+			index:    compound,
+			existing: existingIndex{Key: bson.D{{Key: "postId", Value: -1}, {Key: "email", Value: 1}}, Unique: true},
+			want:     false,
+		},
+		{
+			name:     "not unique",
+			index:    compound,
+			existing: existingIndex{Key: bson.D{{Key: "postId", Value: 1}, {Key: "email", Value: 1}}},
+			want:     false,
+		},
+		{
+			name:     "same expiration",
+			index:    expiring,
+			existing: existingIndex{Key: bson.D{{Key: "createdAt", Value: 1}}, ExpireAfterSeconds: int64(3600)},
+			want:     true,
+		},
+		{
+			name:     "changed expiration",
+			index:    expiring,
+			existing: existingIndex{Key: bson.D{{Key: "createdAt", Value: 1}}, ExpireAfterSeconds: int32(60)},
+			want:     false,
+		},
+		{
+			name:     "expiration added by hand",
+			index:    compound,
+			existing: existingIndex{Key: bson.D{{Key: "postId", Value: 1}, {Key: "email", Value: 1}}, Unique: true, ExpireAfterSeconds: int32(60)},
+			want:     false,
+		},
+		{
+			name:     "text index",
+			index:    text,
+			existing: existingText,
+			want:     true,
+		},
+		{
+			name:  "changed text weights",
+			index: text,
+			existing: existingIndex{
+				Key:     existingText.Key,
+				Weights: bson.M{"title": int32(5), "description": int32(1)},
+			},
+			want: false,
+		},
+		{
+			name:  "text index over other fields",
+			index: text,
+			existing: existingIndex{
+				Key:     existingText.Key,
+				Weights: bson.M{"title": int32(10)},
+			},
+			want: false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.index.matches(test.existing); got != test.want {
+				t.Errorf("matches = %t, want %t", got, test.want)
+			}
+		})
+	}
+}
+
+// Indexes are matched by name, so a name used twice in a collection
+// would make SyncIndexes recreate the index on every run
+func TestAppsIndexNamesAreUnique(t *testing.T) {
+	seen := map[string]bool{}
+	for _, index := range AppsIndexes {
+		name := index.Collection + "." + index.Name
+		if index.Name == "" {
+			t.Errorf("index on %s has no name", index.Collection)
+		}
+		if seen[name] {
+			t.Errorf("duplicate index %s", name)
+		}
+		seen[name] = true
+	}
+}
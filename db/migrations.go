@@ -0,0 +1,266 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// A versioned change to the documents of a database. Migrations are
+// applied in order of their version and recorded in schema_migrations.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(database *mongo.Database) error
+	Down    func(database *mongo.Database) error
+}
+
+// Record of a migration that has been applied to a database
+type AppliedMigration struct {
+	Version   int       `bson:"_id"`
+	Name      string    `bson:"name"`
+	AppliedAt time.Time `bson:"appliedAt"`
+}
+
+func (migration Migration) String() string {
+	return fmt.Sprintf("%03d_%s", migration.Version, migration.Name)
+}
+
+// Migrations can touch every document of a collection, so they get
+// more time than a single request
+var MIGRATION_TIMEOUT = 5 * time.Minute
+
+const migrationsCollection = "schema_migrations"
+
+// Fields of apps.mail that used to be capitalized, in their new casing
+var mailFields = []string{"email", "sender", "header", "body", "schedule", "userName", "createdAt"}
+
+func capitalize(field string) string {
+	return string(field[0]-'a'+'A') + field[1:]
+}
+
+// Migrations of the apps database
+var AppsMigrations = []Migration{
+	{
+		Version: 1,
+		Name:    "backfill_stuff_user_name",
+		// Posts from the old version only have a top-level name
+		Up: func(database *mongo.Database) error {
+			ctx, cancel := context.WithTimeout(context.Background(), MIGRATION_TIMEOUT)
+			defer cancel()
+			_, err := database.Collection("stuff").UpdateMany(ctx,
+				bson.D{
+					{Key: "name", Value: bson.D{{Key: "$nin", Value: bson.A{nil, ""}}}},
+					{Key: "user.name", Value: bson.D{{Key: "$in", Value: bson.A{nil, ""}}}},
+				},
+				bson.A{bson.D{{Key: "$set", Value: bson.D{
+					{Key: "user.name", Value: "$name"},
+					{Key: "user.email", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$user.email", "$email"}}}},
+				}}}},
+			)
+			return err
+		},
+		// The legacy name is kept, so only the copies made by Up are removed
+		Down: func(database *mongo.Database) error {
+			ctx, cancel := context.WithTimeout(context.Background(), MIGRATION_TIMEOUT)
+			defer cancel()
+			_, err := database.Collection("stuff").UpdateMany(ctx,
+				bson.D{
+					{Key: "name", Value: bson.D{{Key: "$nin", Value: bson.A{nil, ""}}}},
+					{Key: "$expr", Value: bson.D{{Key: "$eq", Value: bson.A{"$user.name", "$name"}}}},
+				},
+				bson.D{{Key: "$unset", Value: bson.D{{Key: "user.name", Value: ""}}}},
+			)
+			return err
+		},
+	},
+	{
+		Version: 2,
+		Name:    "lowercase_mail_fields",
+		// apps.mail used capitalized keys while every other collection uses camelCase
+		Up: func(database *mongo.Database) error {
+			renames := bson.D{}
+			for _, field := range mailFields {
+				renames = append(renames, bson.E{Key: capitalize(field), Value: field})
+			}
+			return renameFields(database.Collection("mail"), renames, "Email_1_Schedule_1")
+		},
+		Down: func(database *mongo.Database) error {
+			renames := bson.D{}
+			for _, field := range mailFields {
+				renames = append(renames, bson.E{Key: field, Value: capitalize(field)})
+			}
+			return renameFields(database.Collection("mail"), renames, "email_1_schedule_1")
+		},
+	},
+	{
+		Version: 3,
+		Name:    "normalize_stuff_tags",
+		// Tags are matched exactly against the taxonomy, so older posts
+		// tagged "Request" or "technology" could no longer be edited
+		Up: func(database *mongo.Database) error {
+			ctx, cancel := context.WithTimeout(context.Background(), MIGRATION_TIMEOUT)
+			defer cancel()
+			lower := bson.D{{Key: "$toLower", Value: "$$tag"}}
+			_, err := database.Collection("stuff").UpdateMany(ctx,
+				bson.D{{Key: "tags.0", Value: bson.D{{Key: "$exists", Value: true}}}},
+				bson.A{bson.D{{Key: "$set", Value: bson.D{
+					{Key: "tags", Value: bson.D{{Key: "$map", Value: bson.D{
+						{Key: "input", Value: "$tags"},
+						{Key: "as", Value: "tag"},
+						{Key: "in", Value: bson.D{{Key: "$cond", Value: bson.A{
+							bson.D{{Key: "$eq", Value: bson.A{lower, "technology"}}}, "tech", lower,
+						}}}},
+					}}}},
+				}}}},
+			)
+			return err
+		},
+		// The original spelling of the tags is not kept
+		Down: func(database *mongo.Database) error {
+			return nil
+		},
+	},
+}
+
+// Rename fields in every document of a collection and drop the index
+// built on the old names, if any; SyncIndexes recreates it afterwards
+func renameFields(coll *mongo.Collection, renames bson.D, oldIndex string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), MIGRATION_TIMEOUT)
+	defer cancel()
+	if _, err := coll.UpdateMany(ctx, bson.D{}, bson.D{{Key: "$rename", Value: renames}}); err != nil {
+		return err
+	}
+	existing, err := listIndexes(coll)
+	if err != nil {
+		return err
+	}
+	if _, ok := existing[oldIndex]; ok {
+		_, err = coll.Indexes().DropOne(ctx, oldIndex)
+	}
+	return err
+}
+
+// Get the migrations that have been applied to a database, by version
+func AppliedMigrations(client *mongo.Client, databaseName string) (map[int]AppliedMigration, error) {
+	coll := client.Database(databaseName).Collection(migrationsCollection)
+	ctx, cancel := context.WithTimeout(context.Background(), REQUEST_TIMEOUT)
+	defer cancel()
+
+	cursor, err := coll.Find(ctx, bson.D{}, options.Find())
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var records []AppliedMigration
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	applied := map[int]AppliedMigration{}
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+func sortedMigrations(migrations []Migration) []Migration {
+	sorted := append([]Migration{}, migrations...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+	return sorted
+}
+
+// Apply every pending migration up to and including the target version,
+// or all of them if target is 0. Each migration is recorded as soon as it
+// succeeds, so a failed run can be resumed by running it again.
+// With dryRun, the pending migrations are only returned.
+func MigrateUp(
+	client *mongo.Client,
+	databaseName string,
+	migrations []Migration,
+	target int,
+	dryRun bool,
+) ([]Migration, error) {
+	var done []Migration
+	applied, err := AppliedMigrations(client, databaseName)
+	if err != nil {
+		return done, err
+	}
+
+	database := client.Database(databaseName)
+	for _, migration := range sortedMigrations(migrations) {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		if target > 0 && migration.Version > target {
+			break
+		}
+		if !dryRun {
+			if err := migration.Up(database); err != nil {
+				return done, fmt.Errorf("error applying migration %s: %s", migration, err)
+			}
+			record := AppliedMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}
+			if err := recordMigration(database, record); err != nil {
+				return done, fmt.Errorf("error recording migration %s: %s", migration, err)
+			}
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// Revert the given number of most recently applied migrations, newest first.
+// With dryRun, the migrations that would be reverted are only returned.
+func MigrateDown(
+	client *mongo.Client,
+	databaseName string,
+	migrations []Migration,
+	steps int,
+	dryRun bool,
+) ([]Migration, error) {
+	var done []Migration
+	applied, err := AppliedMigrations(client, databaseName)
+	if err != nil {
+		return done, err
+	}
+
+	database := client.Database(databaseName)
+	sorted := sortedMigrations(migrations)
+	for i := len(sorted) - 1; i >= 0 && len(done) < steps; i-- {
+		migration := sorted[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		if !dryRun {
+			if err := migration.Down(database); err != nil {
+				return done, fmt.Errorf("error reverting migration %s: %s", migration, err)
+			}
+			if err := forgetMigration(database, migration.Version); err != nil {
+				return done, fmt.Errorf("error recording migration %s: %s", migration, err)
+			}
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+func recordMigration(database *mongo.Database, record AppliedMigration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), REQUEST_TIMEOUT)
+	defer cancel()
+	_, err := database.Collection(migrationsCollection).InsertOne(ctx, record)
+	return err
+}
+
+func forgetMigration(database *mongo.Database, version int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), REQUEST_TIMEOUT)
+	defer cancel()
+	_, err := database.Collection(migrationsCollection).DeleteOne(ctx, bson.D{{Key: "_id", Value: version}})
+	return err
+}
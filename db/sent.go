@@ -0,0 +1,56 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Delivery counts for a sent message, updated by Mailjet event callbacks
+type DeliveryStats struct {
+	Sent    int `bson:"sent" json:"sent"`
+	Bounce  int `bson:"bounce" json:"bounce"`
+	Blocked int `bson:"blocked" json:"blocked"`
+	Spam    int `bson:"spam" json:"spam"`
+	Open    int `bson:"open" json:"open"`
+	Click   int `bson:"click" json:"click"`
+}
+
+// A recipient that rejected the message, e.g. a listserv bouncing a blast
+type DeliveryFailure struct {
+	Email string    `bson:"email" json:"email"`
+	Event string    `bson:"event" json:"event"`
+	Error string    `bson:"error" json:"error"`
+	Time  time.Time `bson:"time" json:"time"`
+}
+
+// Record of a message handed off to Mailjet. The ID is passed to Mailjet
+// as the event payload so that delivery events can be matched back to it.
+type SentMessage struct {
+	Id         primitive.ObjectID `bson:"_id" json:"id"`
+	Email      string             `bson:"email" json:"email"`
+	Header     string             `bson:"header" json:"header"`
+	CustomID   string             `bson:"customId" json:"customId"`
+	MessageIDs []int64            `bson:"messageIds" json:"-"`
+	Recipients int                `bson:"recipients" json:"recipients"`
+	Stats      DeliveryStats      `bson:"stats" json:"stats"`
+	Failures   []DeliveryFailure  `bson:"failures" json:"failures"`
+	CreatedAt  time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// Insert a sent message record into apps.sent
+func RecordSent(client *mongo.Client, message SentMessage) error {
+	coll := client.Database("apps").Collection("sent")
+	ctx, cancel := context.WithTimeout(context.Background(), REQUEST_TIMEOUT)
+	defer cancel()
+	if message.CreatedAt.IsZero() {
+		message.CreatedAt = time.Now()
+	}
+	if message.Failures == nil {
+		message.Failures = []DeliveryFailure{}
+	}
+	_, err := coll.InsertOne(ctx, message)
+	return err
+}
@@ -0,0 +1,81 @@
+package digest
+
+import (
+	"context"
+	"html/template"
+	"time"
+
+	"hoagie-profile/db"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Official announcement pinned above every section of the digests sent
+// while it is active, kept in apps.announcements
+type Announcement struct {
+	Id    primitive.ObjectID `bson:"_id" json:"id"`
+	Title string             `bson:"title" json:"title"`
+	// Sanitized HTML
+	Body string `bson:"body" json:"body"`
+	Link string `bson:"link" json:"link"`
+	// Included in the digests sent from StartsAt until EndsAt
+	StartsAt  time.Time `bson:"startsAt" json:"startsAt"`
+	EndsAt    time.Time `bson:"endsAt" json:"endsAt"`
+	CreatedBy string    `bson:"createdBy" json:"createdBy"`
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+}
+
+// An announcement as shown in the digest
+type Pinned struct {
+	Title string
+	Body  template.HTML
+	Link  string
+}
+
+func (announcement Announcement) pinned() Pinned {
+	return Pinned{
+		Title: announcement.Title,
+		// Sanitized when the announcement was created
+		Body: template.HTML(announcement.Body),
+		Link: announcement.Link,
+	}
+}
+
+// Get the announcements active at the given time, oldest first
+func ActiveAnnouncements(client *mongo.Client, now time.Time) ([]Announcement, error) {
+	filter := bson.D{
+		{Key: "startsAt", Value: bson.D{{Key: "$lte", Value: now}}},
+		{Key: "endsAt", Value: bson.D{{Key: "$gt", Value: now}}},
+	}
+	return findAnnouncements(client, filter, bson.D{{Key: "startsAt", Value: 1}})
+}
+
+// Get every announcement, newest first
+func AllAnnouncements(client *mongo.Client) ([]Announcement, error) {
+	return findAnnouncements(client, bson.D{}, bson.D{{Key: "createdAt", Value: -1}})
+}
+
+func findAnnouncements(client *mongo.Client, filter bson.D, sort bson.D) ([]Announcement, error) {
+	cursor, err := db.FindMany(client, "apps", "announcements", filter, options.Find().SetSort(sort))
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), REQUEST_TIMEOUT)
+	defer cancel()
+	defer cursor.Close(ctx)
+
+	announcements := []Announcement{}
+	err = cursor.All(ctx, &announcements)
+	return announcements, err
+}
+
+// Pins the announcements above every section of the digest
+func (d *Digest) Pin(announcements []Announcement) {
+	d.Pinned = nil
+	for _, announcement := range announcements {
+		d.Pinned = append(d.Pinned, announcement.pinned())
+	}
+}
@@ -0,0 +1,360 @@
+package digest
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html"
+	"html/template"
+	"os"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"hoagie-profile/config"
+	"hoagie-profile/format"
+
+	"github.com/microcosm-cc/bluemonday"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+//go:embed templates
+var templateFiles embed.FS
+
+var templateFuncs = template.FuncMap{
+	// Passes several values to a nested template, as pairs of keys and values
+	"dict": func(pairs ...interface{}) map[string]interface{} {
+		values := map[string]interface{}{}
+		for i := 0; i+1 < len(pairs); i += 2 {
+			values[fmt.Sprint(pairs[i])] = pairs[i+1]
+		}
+		return values
+	},
+	"trimScheme": func(url string) string {
+		return strings.TrimPrefix(url, "https://")
+	},
+}
+
+var templates = template.Must(template.New("").Funcs(templateFuncs).ParseFS(templateFiles, "templates/*.html"))
+
+// The plain text part of the digest, for mail clients that do not show HTML
+var textTemplates = texttemplate.Must(texttemplate.New("").Funcs(texttemplate.FuncMap{
+	"dict":       templateFuncs["dict"],
+	"trimScheme": templateFuncs["trimScheme"],
+	"join":       strings.Join,
+	"plain":      plainText,
+}).ParseFS(templateFiles, "templates/*.txt"))
+
+var strictPolicy = bluemonday.StrictPolicy()
+
+// Strips the tags of the admin-written intro for the plain text digest
+func plainText(intro template.HTML) string {
+	return strings.TrimSpace(html.UnescapeString(strictPolicy.Sanitize(string(intro))))
+}
+
+type User struct {
+	Name  string
+	Email string
+}
+
+// Item details of a marketplace post, prices are in cents
+type MarketplaceInfo struct {
+	Price      int64
+	Negotiable bool
+	Condition  string
+	Quantity   int
+	Pickup     string
+}
+
+// Details of a lost & found post
+type LostFoundInfo struct {
+	Kind     string
+	Date     time.Time
+	Location string
+	ItemType string `bson:"itemType"`
+}
+
+// Stuff post as stored in apps.stuff, with the fields shown in the digest
+type Post struct {
+	Id          primitive.ObjectID `bson:"_id"`
+	Title       string
+	Category    string
+	Description string
+	Link        string
+	Thumbnail   string
+	Email       string
+	Tags        []string
+	User        User
+	Marketplace *MarketplaceInfo
+	LostFound   *LostFoundInfo `bson:"lostFound"`
+	Private     bool
+	CreatedAt   time.Time `bson:"createdAt"`
+}
+
+// A rendered digest and the posts it includes, by section
+type Digest struct {
+	Date  time.Time
+	Intro template.HTML
+	// Announcements shown above every section
+	Pinned   []Pinned
+	Sections []Section
+	Total    int
+	// One-click unsubscribe link of a personal digest
+	UnsubscribeURL string
+}
+
+// Posts of one category group, such as the Marketplace
+type Section struct {
+	Key string
+	// Group of the section, which decides how its posts are shown
+	Group string
+	Title string
+	// Where the section can be seen on Hoagie Stuff
+	URL   string
+	Items []Item
+}
+
+// A post as shown in the digest
+type Item struct {
+	Id    primitive.ObjectID
+	Title string
+	// "LOST" or "FOUND" for lost & found posts
+	Label       string
+	Description string
+	Details     []Detail
+	Tags        []string
+	Contact     Contact
+	PictureURL  string
+	// Google Slides of older sale posts
+	SlidesURL string
+}
+
+type Detail struct {
+	Label string
+	Value string
+}
+
+// Private posts are only reachable through the contact relay of Hoagie Stuff
+type Contact struct {
+	Name  string
+	Email string
+	URL   string
+}
+
+// Returns the key of the section a post is shown in, which is its category
+// except for the legacy categories of a group, such as the marketplace
+func sectionKey(category string, taxonomy config.Taxonomy) string {
+	section, _ := taxonomy.Section(category)
+	return section.Key
+}
+
+// Returns the posts in the order of the digest configuration: oldest first,
+// after the posts with a priority tag for OrderPriority
+func sortPosts(posts []Post, digestConfig config.Digest) []Post {
+	sorted := append([]Post{}, posts...)
+	priority := digestConfig.PostOrder == config.OrderPriority
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if priority {
+			iPriority, jPriority := digestConfig.IsPriority(sorted[i].Tags), digestConfig.IsPriority(sorted[j].Tags)
+			if iPriority != jPriority {
+				return iPriority
+			}
+		}
+		return sorted[i].CreatedAt.Before(sorted[j].CreatedAt)
+	})
+	return sorted
+}
+
+// Builds the digest of the given posts sent at the given time. Sections are
+// ordered as configured, followed by any other sections of the taxonomy, and
+// titled after it. Posts of unknown categories are left out.
+func New(posts []Post, digestConfig config.Digest, taxonomy config.Taxonomy, now time.Time) Digest {
+	digest := Digest{
+		Date:  now,
+		Intro: template.HTML(digestConfig.IntroFor(now)),
+	}
+	bySection := map[string][]Item{}
+	for _, post := range sortPosts(posts, digestConfig) {
+		key := sectionKey(post.Category, taxonomy)
+		bySection[key] = append(bySection[key], newItem(post, taxonomy.Group(post.Category)))
+	}
+	keys := append([]string{}, digestConfig.Sections()...)
+	for _, section := range taxonomy.Sections() {
+		if !contains(keys, section.Key) {
+			keys = append(keys, section.Key)
+		}
+	}
+	for _, key := range keys {
+		if !taxonomy.IsSection(key) {
+			continue
+		}
+		section, _ := taxonomy.Category(key)
+		items := bySection[key]
+		if len(items) == 0 {
+			continue
+		}
+		digest.Sections = append(digest.Sections, Section{
+			Key:   key,
+			Group: section.Group,
+			Title: strings.TrimSpace(section.Emoji + " " + section.Name),
+			URL:   section.URL,
+			Items: items,
+		})
+		digest.Total += len(items)
+	}
+	return digest
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the IDs of every post in the digest
+func (d Digest) PostIds() []primitive.ObjectID {
+	var ids []primitive.ObjectID
+	for _, section := range d.Sections {
+		for _, item := range section.Items {
+			ids = append(ids, item.Id)
+		}
+	}
+	return ids
+}
+
+func (d Digest) Subject() string {
+	return fmt.Sprintf("📬 DIGEST %s: Sales, Lost & Found, and more!", d.Date.In(eastern()).Format("1/2"))
+}
+
+// Renders the digest email
+func (d Digest) HTML() (string, error) {
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, "digest.html", d); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Renders the plain text part of the digest email
+func (d Digest) Text() (string, error) {
+	var buf bytes.Buffer
+	if err := textTemplates.ExecuteTemplate(&buf, "digest.txt", d); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func eastern() *time.Location {
+	if est, err := time.LoadLocation("America/New_York"); err == nil {
+		return est
+	}
+	return time.UTC
+}
+
+func newItem(post Post, group string) Item {
+	item := Item{
+		Id:          post.Id,
+		Title:       post.Title,
+		Description: post.Description,
+		Tags:        post.Tags,
+		Contact: Contact{
+			Name:  post.User.Name,
+			Email: post.Email,
+			URL:   "mailto:" + post.Email,
+		},
+	}
+	if post.Private {
+		item.Contact.Email = ""
+		item.Contact.URL = "https://stuff.hoagie.io/"
+	}
+	switch group {
+	case "marketplace":
+		// TODO: Old version, remove
+		item.SlidesURL = post.Link
+		if len(item.Tags) == 0 {
+			item.Tags = strings.Split(post.Title, ", ")
+		}
+		if post.Marketplace != nil {
+			item.Details = marketplaceDetails(*post.Marketplace)
+		}
+	case "lost":
+		item.Tags = nil
+		item.Label = strings.ToUpper(lostFoundKind(post))
+		if post.Thumbnail != "" {
+			item.PictureURL = thumbnailLink(post.Thumbnail)
+		}
+		if post.LostFound != nil {
+			item.Details = lostFoundDetails(*post.LostFound)
+		}
+	}
+	var tags []string
+	for _, tag := range item.Tags {
+		tags = append(tags, strings.Title(tag))
+	}
+	item.Tags = tags
+	return item
+}
+
+// Thumbnails are IDs of images uploaded to the API, except for
+// older posts that link to Imgur directly
+func thumbnailLink(thumbnail string) string {
+	if strings.HasPrefix(thumbnail, "https://") {
+		return thumbnail
+	}
+	return fmt.Sprintf("https://%s/stuff/images/%s/", os.Getenv("HOAGIE_HOST"), thumbnail)
+}
+
+// Older lost & found posts only had their kind as the first tag, if at all
+func lostFoundKind(post Post) string {
+	if post.LostFound != nil && post.LostFound.Kind != "" {
+		return post.LostFound.Kind
+	}
+	if len(post.Tags) > 0 {
+		return post.Tags[0]
+	}
+	return "lost"
+}
+
+var conditionNames = map[string]string{
+	"new":      "New",
+	"like-new": "Like new",
+	"good":     "Good",
+	"fair":     "Fair",
+	"poor":     "Poor",
+}
+
+func marketplaceDetails(info MarketplaceInfo) []Detail {
+	price := format.Price(info.Price)
+	if info.Negotiable {
+		price += " (negotiable)"
+	}
+	details := []Detail{{Label: "Price", Value: price}}
+	if condition, ok := conditionNames[info.Condition]; ok {
+		details = append(details, Detail{Label: "Condition", Value: condition})
+	}
+	if info.Quantity > 1 {
+		details = append(details, Detail{Label: "Quantity", Value: fmt.Sprint(info.Quantity)})
+	}
+	if info.Pickup != "" {
+		details = append(details, Detail{Label: "Pickup", Value: info.Pickup})
+	}
+	return details
+}
+
+func lostFoundDetails(info LostFoundInfo) []Detail {
+	var details []Detail
+	if location, ok := config.CampusLocations[info.Location]; ok {
+		details = append(details, Detail{Label: "Where", Value: location})
+	}
+	if !info.Date.IsZero() {
+		details = append(details, Detail{Label: "When", Value: info.Date.In(eastern()).Format("Mon, Jan 2")})
+	}
+	if itemType, ok := config.ItemTypes[info.ItemType]; ok {
+		details = append(details, Detail{Label: "Item", Value: itemType})
+	}
+	return details
+}
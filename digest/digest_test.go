@@ -0,0 +1,292 @@
+package digest
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"hoagie-profile/config"
+)
+
+// Run `go test ./digest -update` to rewrite the golden files after an
+// intended change to the templates, then review the diff
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+// Tuesday, March 5th 2024 at noon in Princeton
+var digestDay = time.Date(2024, time.March, 5, 17, 0, 0, 0, time.UTC)
+
+func loadPosts(t *testing.T) []Post {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "posts.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var posts []Post
+	if err := json.Unmarshal(data, &posts); err != nil {
+		t.Fatal(err)
+	}
+	return posts
+}
+
+func checkGolden(t *testing.T, name string, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("missing golden file, run with -update: %s", err)
+	}
+	if got != string(want) {
+		gotLines, wantLines := strings.Split(got, "\n"), strings.Split(string(want), "\n")
+		for i := 0; i < len(gotLines) || i < len(wantLines); i++ {
+			var gotLine, wantLine string
+			if i < len(gotLines) {
+				gotLine = gotLines[i]
+			}
+			if i < len(wantLines) {
+				wantLine = wantLines[i]
+			}
+			if gotLine != wantLine {
+				t.Fatalf("%s differs at line %d:\n got: %s\nwant: %s", path, i+1, gotLine, wantLine)
+			}
+		}
+	}
+}
+
+func TestRenderGolden(t *testing.T) {
+	t.Setenv("HOAGIE_HOST", "api.hoagie.io")
+	posts := loadPosts(t)
+
+	summer := config.DefaultDigest()
+	summer.Summer = []config.DateRange{{Start: "2024-03-01", End: "2024-03-10"}}
+	pinned := []Announcement{{
+		Title: "Dining halls close early on Friday",
+		Body:  "<p>All dining halls close at <b>7pm</b> on Friday.</p>",
+		Link:  "https://hoagie.io/",
+	}}
+
+	tests := []struct {
+		name   string
+		posts  []Post
+		config config.Digest
+		pinned []Announcement
+	}{
+		{name: "full", posts: posts, config: config.DefaultDigest()},
+		{name: "summer", posts: posts[:3], config: summer},
+		{name: "single", posts: posts[:1], config: config.DefaultDigest()},
+		{name: "pinned", posts: posts[:3], config: config.DefaultDigest(), pinned: pinned},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			digest := New(test.posts, test.config, config.DefaultTaxonomy(), digestDay)
+			digest.Pin(test.pinned)
+			rendered, err := digest.HTML()
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, test.name+".golden.html", rendered)
+			text, err := digest.Text()
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, test.name+".golden.txt", text)
+		})
+	}
+}
+
+func TestSections(t *testing.T) {
+	digest := New(loadPosts(t), config.DefaultDigest(), config.DefaultTaxonomy(), digestDay)
+
+	var keys []string
+	for _, section := range digest.Sections {
+		keys = append(keys, section.Key)
+	}
+	if strings.Join(keys, ",") != "lost,sale,bulletin" {
+		t.Errorf("sections = %v, want lost, sale and bulletin in order", keys)
+	}
+	if digest.Total != 7 || len(digest.PostIds()) != 7 {
+		t.Errorf("total = %d with %d IDs, want 7", digest.Total, len(digest.PostIds()))
+	}
+	if subject := digest.Subject(); subject != "📬 DIGEST 3/5: Sales, Lost & Found, and more!" {
+		t.Errorf("subject = %q", subject)
+	}
+}
+
+func TestTaxonomySections(t *testing.T) {
+	taxonomy := config.DefaultTaxonomy()
+	taxonomy.Categories[0].Name = "Lost Items"
+	taxonomy.Categories[0].Emoji = "🔎"
+	// Leave out the bulletins, and add a category after the configured sections
+	taxonomy.Categories = append(taxonomy.Categories[:4], config.Category{
+		Key: "housing", Name: "Housing", Emoji: "🏠", Group: "housing", URL: "https://stuff.hoagie.io/housing",
+	})
+	if err := taxonomy.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	posts := append(loadPosts(t), Post{Title: "Summer sublet", Category: "housing", Description: "Two rooms on Nassau."})
+	digest := New(posts, config.DefaultDigest(), taxonomy, digestDay)
+
+	var titles []string
+	for _, section := range digest.Sections {
+		titles = append(titles, section.Title)
+	}
+	if strings.Join(titles, ",") != "🔎 Lost Items,🛍️ Marketplace,🏠 Housing" {
+		t.Errorf("titles = %v", titles)
+	}
+	if digest.Sections[1].Key != "sale" || len(digest.Sections[1].Items) != 3 {
+		t.Errorf("marketplace section = %s with %d posts, want sale with every marketplace post", digest.Sections[1].Key, len(digest.Sections[1].Items))
+	}
+}
+
+func TestOrdering(t *testing.T) {
+	posts := loadPosts(t)
+	// Reversed, so that posts are only in order if they are sorted
+	var reversed []Post
+	for i := len(posts) - 1; i >= 0; i-- {
+		reversed = append(reversed, posts[i])
+	}
+	digestConfig := config.DefaultDigest()
+	digestConfig.SectionOrder = []string{"bulletin", "sale", "lost"}
+
+	titles := func(d Digest) []string {
+		var titles []string
+		for _, item := range d.Sections[0].Items {
+			titles = append(titles, item.Title)
+		}
+		return titles
+	}
+
+	created := New(reversed, digestConfig, config.DefaultTaxonomy(), digestDay)
+	if created.Sections[0].Key != "bulletin" || created.Sections[2].Key != "lost" {
+		t.Errorf("sections are not in the configured order")
+	}
+	if got := strings.Join(titles(created), ", "); got != "Looking for uber sharing, Looking for a roommate" {
+		t.Errorf("bulletins by creation = %s", got)
+	}
+
+	digestConfig.PostOrder = config.OrderPriority
+	priority := New(reversed, digestConfig, config.DefaultTaxonomy(), digestDay)
+	if got := strings.Join(titles(priority), ", "); got != "Looking for a roommate, Looking for uber sharing" {
+		t.Errorf("bulletins by priority = %s, want the announcement first", got)
+	}
+}
+
+func TestUserContentIsEscaped(t *testing.T) {
+	rendered, err := New(loadPosts(t), config.DefaultDigest(), config.DefaultTaxonomy(), digestDay).HTML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, unsafe := range []string{"<script>", "<b>desk</b>", "<i>Tomato</i>"} {
+		if strings.Contains(rendered, unsafe) {
+			t.Errorf("rendered digest contains unescaped %q", unsafe)
+		}
+	}
+	// The private post of Veggie Hoagie links to Hoagie Stuff instead of their email
+	private := `Veggie Hoagie (<a target="_blank" href="https://stuff.hoagie.io/">message on Hoagie Stuff</a>)`
+	if !strings.Contains(rendered, private) {
+		t.Errorf("private post does not hide the email of the poster")
+	}
+}
+
+func TestPersonalDigest(t *testing.T) {
+	t.Setenv("HOAGIE_HOST", "api.hoagie.io")
+	posts := loadPosts(t)
+	earlier, later := digestDay.Add(-48*time.Hour), digestDay.Add(-time.Hour)
+	var sent []sentPost
+	for i, post := range posts {
+		sentAt := later
+		if i%2 == 0 {
+			sentAt = earlier
+		}
+		sent = append(sent, sentPost{post: post, sentAt: sentAt})
+	}
+	sub := Subscription{
+		Sections:     []string{"sale", "lost"},
+		Frequency:    FrequencyEach,
+		Email:        "veggie@princeton.edu",
+		LastDigestAt: earlier,
+	}
+
+	personal, lastDigestAt := sub.digest(sent, []time.Time{earlier, later}, config.DefaultDigest(), config.DefaultTaxonomy(), digestDay)
+	if !lastDigestAt.Equal(later) {
+		t.Errorf("last digest at %s, want %s", lastDigestAt, later)
+	}
+	for _, section := range personal.Sections {
+		if section.Key == "bulletin" {
+			t.Errorf("personal digest includes a section the subscriber did not choose")
+		}
+	}
+	for _, id := range personal.PostIds() {
+		for i, post := range posts {
+			if post.Id == id && i%2 == 0 {
+				t.Errorf("personal digest includes %q from a digest that was already sent", post.Title)
+			}
+		}
+	}
+	if personal.Total == 0 {
+		t.Fatal("personal digest is empty")
+	}
+	rendered, err := personal.HTML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(rendered, `href="https://api.hoagie.io/unsubscribe/?token=`) {
+		t.Errorf("personal digest has no unsubscribe link")
+	}
+}
+
+func TestRenamedCategoriesKeepTheirDetails(t *testing.T) {
+	taxonomy := config.DefaultTaxonomy()
+	taxonomy.Categories[0].Key = "lost-items"
+	taxonomy.Categories[1].Key = "market"
+	if err := taxonomy.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	posts := []Post{
+		{Title: "Desk", Category: "market", Description: "A desk.", Marketplace: &MarketplaceInfo{Price: 2500, Condition: "good"}},
+		{Title: "Keys", Category: "lost-items", Description: "On a red lanyard.", LostFound: &LostFoundInfo{Kind: "found", Location: "butler"}},
+	}
+	digest := New(posts, config.DefaultDigest(), taxonomy, digestDay)
+
+	items := map[string]Item{}
+	for _, section := range digest.Sections {
+		for _, item := range section.Items {
+			items[item.Title] = item
+		}
+	}
+	if desk := items["Desk"]; len(desk.Details) == 0 || desk.Details[0].Value != "$25" {
+		t.Errorf("marketplace details = %v, want the price", desk.Details)
+	}
+	if keys := items["Keys"]; keys.Label != "FOUND" || len(keys.Details) == 0 {
+		t.Errorf("lost & found item = %+v, want its kind and details", keys)
+	}
+}
+
+func TestReconcileStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   string
+		recorded bool
+		want     string
+	}{
+		{"sending with a sent record", StatusSending, true, StatusSent},
+		{"sending without a sent record", StatusSending, false, StatusUnconfirmed},
+		{"sent with unmarked posts", StatusSent, true, StatusSent},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := reconcileStatus(Record{Status: test.status}, test.recorded); got != test.want {
+				t.Errorf("reconcileStatus = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
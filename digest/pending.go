@@ -0,0 +1,124 @@
+package digest
+
+import (
+	"context"
+	"time"
+
+	"hoagie-profile/config"
+	"hoagie-profile/db"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var REQUEST_TIMEOUT = 10 * time.Second
+
+// What the next digest would contain if it were sent now
+type Preview struct {
+	Subject  string `json:"subject"`
+	WillSend bool   `json:"willSend"`
+	Total    int    `json:"total"`
+	// Titles of the pinned announcements
+	Pinned   []string         `json:"pinned"`
+	Sections []SectionSummary `json:"sections"`
+	HTML     string           `json:"html"`
+}
+
+type SectionSummary struct {
+	Key   string        `json:"key"`
+	Title string        `json:"title"`
+	Posts []PostSummary `json:"posts"`
+}
+
+type PostSummary struct {
+	Id    string `json:"id"`
+	Title string `json:"title"`
+}
+
+// Filter for the posts waiting for the next digest. Resolved, expired
+// and hidden posts are left out, including older posts without an
+// expiration once they are past the legacy expiration.
+func pendingFilter(now time.Time) bson.D {
+	return bson.D{
+		{Key: "sent", Value: false},
+		{Key: "state", Value: bson.D{{Key: "$ne", Value: "resolved"}}},
+		{Key: "hidden", Value: bson.D{{Key: "$ne", Value: true}}},
+		config.UnexpiredFilter(now),
+	}
+}
+
+// Get the posts waiting for the next digest, oldest first
+func PendingPosts(client *mongo.Client, now time.Time) ([]Post, error) {
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{Key: "createdAt", Value: 1}})
+	cursor, err := db.FindMany(client, "apps", "stuff", pendingFilter(now), findOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), REQUEST_TIMEOUT)
+	defer cancel()
+	defer cursor.Close(ctx)
+
+	var posts []Post
+	err = cursor.All(ctx, &posts)
+	return posts, err
+}
+
+// Builds the digest that would be sent now, along with the digest
+// configuration it was built with
+func Next(client *mongo.Client, now time.Time) (Digest, config.Digest, error) {
+	digestConfig, err := config.LoadDigest(client)
+	if err != nil {
+		return Digest{}, digestConfig, err
+	}
+	taxonomy, err := config.LoadTaxonomy(client)
+	if err != nil {
+		return Digest{}, digestConfig, err
+	}
+	posts, err := PendingPosts(client, now)
+	if err != nil {
+		return Digest{}, digestConfig, err
+	}
+	announcements, err := ActiveAnnouncements(client, now)
+	if err != nil {
+		return Digest{}, digestConfig, err
+	}
+	next := New(posts, digestConfig, taxonomy, now)
+	next.Pin(announcements)
+	return next, digestConfig, nil
+}
+
+// Summarizes which sections and posts the digest includes
+func (d Digest) Summary() []SectionSummary {
+	summary := []SectionSummary{}
+	for _, section := range d.Sections {
+		sectionSummary := SectionSummary{Key: section.Key, Title: section.Title, Posts: []PostSummary{}}
+		for _, item := range section.Items {
+			sectionSummary.Posts = append(sectionSummary.Posts, PostSummary{Id: item.Id.Hex(), Title: item.Title})
+		}
+		summary = append(summary, sectionSummary)
+	}
+	return summary
+}
+
+// Renders a preview of the digest without sending it
+func (d Digest) Preview(digestConfig config.Digest) (Preview, error) {
+	html, err := d.HTML()
+	if err != nil {
+		return Preview{}, err
+	}
+	pinned := []string{}
+	for _, announcement := range d.Pinned {
+		pinned = append(pinned, announcement.Title)
+	}
+	return Preview{
+		Subject:  d.Subject(),
+		WillSend: digestConfig.ShouldSend(d.Total, d.Date),
+		Total:    d.Total,
+		Pinned:   pinned,
+		Sections: d.Summary(),
+		HTML:     html,
+	}, nil
+}
@@ -0,0 +1,311 @@
+package digest
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"hoagie-profile/config"
+	"hoagie-profile/db"
+	"hoagie-profile/mail"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// How often a subscriber gets their personal digest
+const (
+	FrequencyEach   = "each"
+	FrequencyWeekly = "weekly"
+)
+
+const WEEK = 7 * 24 * time.Hour
+
+// Personal digest subscription, kept in apps.subscriptions
+type Subscription struct {
+	Id    primitive.ObjectID `bson:"_id"`
+	Email string
+	Name  string
+	// Keys of the sections the subscriber wants, such as "sale"
+	Sections  []string
+	Frequency string
+	CreatedAt time.Time `bson:"createdAt"`
+	// When the last personal digest was sent, and when the newest
+	// listserv digest it included was sent
+	LastSentAt   time.Time `bson:"lastSentAt"`
+	LastDigestAt time.Time `bson:"lastDigestAt"`
+}
+
+// Listserv digests sent after this time are included in the next personal
+// digest of the subscriber
+func (sub Subscription) since() time.Time {
+	if !sub.LastDigestAt.IsZero() {
+		return sub.LastDigestAt
+	}
+	return sub.CreatedAt
+}
+
+// Weekly subscribers get at most one digest a week
+func (sub Subscription) due(now time.Time) bool {
+	return sub.Frequency != FrequencyWeekly || now.Sub(sub.LastSentAt) >= WEEK
+}
+
+func (sub Subscription) wants(post Post, taxonomy config.Taxonomy) bool {
+	key := sectionKey(post.Category, taxonomy)
+	for _, section := range sub.Sections {
+		if section == key {
+			return true
+		}
+	}
+	return false
+}
+
+// A post of a sent listserv digest, with the time the digest was sent
+type sentPost struct {
+	post   Post
+	sentAt time.Time
+}
+
+// Builds the personal digest of a subscriber from the posts of the listserv
+// digests they have not received yet, given when each listserv digest was
+// sent. The second return value is when the newest of those was sent.
+func (sub Subscription) digest(posts []sentPost, sentTimes []time.Time, digestConfig config.Digest, taxonomy config.Taxonomy, now time.Time) (Digest, time.Time) {
+	since := sub.since()
+	var lastDigestAt time.Time
+	for _, sentAt := range sentTimes {
+		if sentAt.After(since) && sentAt.After(lastDigestAt) {
+			lastDigestAt = sentAt
+		}
+	}
+	var included []Post
+	for _, sent := range posts {
+		if sent.sentAt.After(since) && sub.wants(sent.post, taxonomy) {
+			included = append(included, sent.post)
+		}
+	}
+	personal := New(included, digestConfig, taxonomy, now)
+	personal.UnsubscribeURL = mail.UnsubscribeURL(sub.Email, mail.ListDigest)
+	return personal, lastDigestAt
+}
+
+func loadSubscriptions(client *mongo.Client) ([]Subscription, error) {
+	cursor, err := db.FindMany(client, "apps", "subscriptions", bson.D{}, options.Find())
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), REQUEST_TIMEOUT)
+	defer cancel()
+	defer cursor.Close(ctx)
+
+	var subscriptions []Subscription
+	err = cursor.All(ctx, &subscriptions)
+	return subscriptions, err
+}
+
+// Loads the posts of the listserv digests sent after the given time,
+// leaving out posts that were hidden or resolved since, along with when
+// each of those digests was sent
+func loadSentPosts(client *mongo.Client, since time.Time) ([]sentPost, []time.Time, error) {
+	filter := bson.D{
+		{Key: "status", Value: StatusSent},
+		{Key: "sentAt", Value: bson.D{{Key: "$gt", Value: since}}},
+	}
+	findOptions := options.Find().SetProjection(bson.D{{Key: "html", Value: 0}, {Key: "text", Value: 0}})
+	cursor, err := db.FindMany(client, "apps", "digests", filter, findOptions)
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), REQUEST_TIMEOUT)
+	defer cancel()
+	defer cursor.Close(ctx)
+
+	var records []Record
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, nil, err
+	}
+	sentAt := map[primitive.ObjectID]time.Time{}
+	var sentTimes []time.Time
+	var postIds []primitive.ObjectID
+	for _, record := range records {
+		sentTimes = append(sentTimes, record.SentAt)
+		for _, id := range record.PostIds {
+			sentAt[id] = record.SentAt
+			postIds = append(postIds, id)
+		}
+	}
+	if len(postIds) == 0 {
+		return nil, sentTimes, nil
+	}
+
+	postFilter := bson.D{
+		{Key: "_id", Value: bson.D{{Key: "$in", Value: postIds}}},
+		{Key: "state", Value: bson.D{{Key: "$ne", Value: "resolved"}}},
+		{Key: "hidden", Value: bson.D{{Key: "$ne", Value: true}}},
+	}
+	postOptions := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+	postCursor, err := db.FindMany(client, "apps", "stuff", postFilter, postOptions)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer postCursor.Close(ctx)
+
+	var posts []Post
+	if err := postCursor.All(ctx, &posts); err != nil {
+		return nil, nil, err
+	}
+	var sentPosts []sentPost
+	for _, post := range posts {
+		sentPosts = append(sentPosts, sentPost{post: post, sentAt: sentAt[post.Id]})
+	}
+	return sentPosts, sentTimes, nil
+}
+
+// A personal digest waiting to be sent
+type personalDigest struct {
+	subscription Subscription
+	digest       Digest
+	lastDigestAt time.Time
+}
+
+func (personal personalDigest) message() (mail.Message, error) {
+	html, err := personal.digest.HTML()
+	if err != nil {
+		return mail.Message{}, err
+	}
+	text, err := personal.digest.Text()
+	if err != nil {
+		return mail.Message{}, err
+	}
+	return mail.Message{
+		To:       personal.subscription.Email,
+		ToName:   personal.subscription.Name,
+		Subject:  personal.digest.Subject(),
+		HTML:     html,
+		Text:     text,
+		CustomID: "HoagieStuffPersonalDigest",
+		List:     mail.ListDigest,
+	}, nil
+}
+
+// Builds the personal digests that are due now, including empty ones for
+// subscribers whose sections had no new posts
+func duePersonalDigests(client *mongo.Client, now time.Time) ([]personalDigest, error) {
+	subscriptions, err := loadSubscriptions(client)
+	if err != nil || len(subscriptions) == 0 {
+		return nil, err
+	}
+	digestConfig, err := config.LoadDigest(client)
+	if err != nil {
+		return nil, err
+	}
+	taxonomy, err := config.LoadTaxonomy(client)
+	if err != nil {
+		return nil, err
+	}
+
+	var due []Subscription
+	oldest := now
+	for _, sub := range subscriptions {
+		if !sub.due(now) {
+			continue
+		}
+		due = append(due, sub)
+		if sub.since().Before(oldest) {
+			oldest = sub.since()
+		}
+	}
+	if len(due) == 0 {
+		return nil, nil
+	}
+	posts, sentTimes, err := loadSentPosts(client, oldest)
+	if err != nil {
+		return nil, err
+	}
+	announcements, err := ActiveAnnouncements(client, now)
+	if err != nil {
+		return nil, err
+	}
+
+	var personalDigests []personalDigest
+	for _, sub := range due {
+		personal, lastDigestAt := sub.digest(posts, sentTimes, digestConfig, taxonomy, now)
+		personal.Pin(announcements)
+		personalDigests = append(personalDigests, personalDigest{
+			subscription: sub,
+			digest:       personal,
+			lastDigestAt: lastDigestAt,
+		})
+	}
+	return personalDigests, nil
+}
+
+// Sends the personal digests that are due, in batches. Subscribers are
+// marked after each batch is sent, so a failed run only resends the batch
+// that failed. Returns the number of digests sent.
+func SendPersonal(client *mongo.Client, now time.Time, dryRun bool) (int, error) {
+	due, err := duePersonalDigests(client, now)
+	if err != nil {
+		return 0, err
+	}
+	var personalDigests []personalDigest
+	for _, personal := range due {
+		if personal.digest.Total > 0 {
+			personalDigests = append(personalDigests, personal)
+			continue
+		}
+		// Skip the digests that had nothing for the subscriber, so they
+		// are not loaded again on the next run
+		if dryRun || personal.lastDigestAt.IsZero() {
+			continue
+		}
+		_, err := db.UpdateOne(client, "apps", "subscriptions",
+			bson.D{{Key: "_id", Value: personal.subscription.Id}},
+			bson.D{{Key: "$set", Value: bson.D{{Key: "lastDigestAt", Value: personal.lastDigestAt}}}},
+		)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if dryRun {
+		for _, personal := range personalDigests {
+			fmt.Printf("Personal digest to %s with %d posts\n", personal.subscription.Email, personal.digest.Total)
+		}
+		return 0, nil
+	}
+
+	sent := 0
+	for start := 0; start < len(personalDigests); start += mail.BATCH_SIZE {
+		end := start + mail.BATCH_SIZE
+		if end > len(personalDigests) {
+			end = len(personalDigests)
+		}
+		batch := personalDigests[start:end]
+		var messages []mail.Message
+		for _, personal := range batch {
+			message, err := personal.message()
+			if err != nil {
+				return sent, err
+			}
+			messages = append(messages, message)
+		}
+		if err := mail.Send(client, "Hoagie Mail", messages); err != nil {
+			return sent, err
+		}
+		for _, personal := range batch {
+			_, err := db.UpdateOne(client, "apps", "subscriptions",
+				bson.D{{Key: "_id", Value: personal.subscription.Id}},
+				bson.D{{Key: "$set", Value: bson.D{
+					{Key: "lastSentAt", Value: now},
+					{Key: "lastDigestAt", Value: personal.lastDigestAt},
+				}}},
+			)
+			if err != nil {
+				return sent, err
+			}
+		}
+		sent += len(batch)
+	}
+	return sent, nil
+}
@@ -0,0 +1,213 @@
+package digest
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"hoagie-profile/db"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Statuses of a digest run
+const (
+	// Set before the digest is handed to Mailjet
+	StatusSending = "sending"
+	StatusSent    = "sent"
+	StatusFailed  = "failed"
+	// Set for a run that stopped while sending with no record of its email
+	// in apps.sent, which has to be checked in Mailjet by hand
+	StatusUnconfirmed = "unconfirmed"
+)
+
+// History of digest runs, kept in apps.digests. The ID of a record is also
+// the ID of the apps.sent record of its email.
+type Record struct {
+	Id      primitive.ObjectID   `bson:"_id" json:"id"`
+	Subject string               `bson:"subject" json:"subject"`
+	PostIds []primitive.ObjectID `bson:"postIds" json:"postIds"`
+	Status  string               `bson:"status" json:"status"`
+	// Mailjet message IDs of the email, set along with the sent status
+	MessageIDs []int64 `bson:"messageIds,omitempty" json:"-"`
+	// Set once every post of a sent digest is marked as sent
+	PostsMarked bool      `bson:"postsMarked" json:"-"`
+	Error       string    `bson:"error,omitempty" json:"-"`
+	CreatedAt   time.Time `bson:"createdAt" json:"createdAt"`
+	SentAt      time.Time `bson:"sentAt,omitempty" json:"sentAt"`
+	// The email as it was sent, left out of archive listings
+	HTML string `bson:"html,omitempty" json:"html,omitempty"`
+	Text string `bson:"text,omitempty" json:"text,omitempty"`
+}
+
+// Records a digest that is about to be sent, along with its rendered email
+func CreateRecord(client *mongo.Client, d Digest, html string, text string) (Record, error) {
+	record := Record{
+		Id:        primitive.NewObjectID(),
+		Subject:   d.Subject(),
+		PostIds:   d.PostIds(),
+		Status:    StatusSending,
+		CreatedAt: time.Now(),
+		HTML:      html,
+		Text:      text,
+	}
+	_, err := db.InsertOne(client, "apps", "digests", bson.D{
+		{Key: "_id", Value: record.Id},
+		{Key: "subject", Value: record.Subject},
+		{Key: "postIds", Value: record.PostIds},
+		{Key: "status", Value: record.Status},
+		{Key: "postsMarked", Value: false},
+		{Key: "createdAt", Value: record.CreatedAt},
+		{Key: "html", Value: record.HTML},
+		{Key: "text", Value: record.Text},
+	})
+	return record, err
+}
+
+// Records that sending a digest failed, leaving its posts for the next run
+func MarkFailed(client *mongo.Client, record Record, sendErr error) error {
+	_, err := db.UpdateOne(client, "apps", "digests",
+		bson.D{{Key: "_id", Value: record.Id}},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "status", Value: StatusFailed},
+			{Key: "error", Value: sendErr.Error()},
+		}}},
+	)
+	return err
+}
+
+// Records that a digest was sent, along with the Mailjet message IDs of
+// its email if they are known, and marks exactly its posts as sent.
+// Running it again for the same digest is harmless.
+func MarkSent(client *mongo.Client, record Record, messageIDs []int64) error {
+	_, err := db.UpdateOne(client, "apps", "digests",
+		bson.D{{Key: "_id", Value: record.Id}, {Key: "status", Value: bson.D{{Key: "$ne", Value: StatusSent}}}},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "status", Value: StatusSent},
+			{Key: "messageIds", Value: messageIDs},
+			{Key: "sentAt", Value: time.Now()},
+		}}},
+	)
+	if err != nil {
+		return err
+	}
+	if len(record.PostIds) > 0 {
+		_, err = db.UpdateMany(client, "apps", "stuff",
+			bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: record.PostIds}}}},
+			bson.D{{Key: "$set", Value: bson.D{
+				{Key: "sent", Value: true},
+				{Key: "digestId", Value: record.Id},
+			}}},
+			options.Update(),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = db.UpdateOne(client, "apps", "digests",
+		bson.D{{Key: "_id", Value: record.Id}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "postsMarked", Value: true}}}},
+	)
+	return err
+}
+
+// Records that a digest stopped while sending and its email may not have
+// gone out, leaving its posts for the next run
+func MarkUnconfirmed(client *mongo.Client, record Record) error {
+	_, err := db.UpdateOne(client, "apps", "digests",
+		bson.D{{Key: "_id", Value: record.Id}, {Key: "status", Value: StatusSending}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "status", Value: StatusUnconfirmed}}}},
+	)
+	return err
+}
+
+// Decides how to finish a run, given whether apps.sent has a record of
+// its email. Only a run whose email is known to have gone out is sent.
+func reconcileStatus(record Record, recorded bool) string {
+	if record.Status == StatusSending && !recorded {
+		return StatusUnconfirmed
+	}
+	return StatusSent
+}
+
+// Finishes digest runs that stopped halfway. A run that stopped while
+// sending is marked as sent along with its posts if apps.sent has a record
+// of its email, and as unconfirmed otherwise, with its posts left unsent.
+// Sent digests whose posts were not all marked are marked again. Returns
+// the number of digests that were finished.
+func Reconcile(client *mongo.Client) (int, error) {
+	filter := bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "status", Value: StatusSending}},
+		bson.D{{Key: "status", Value: StatusSent}, {Key: "postsMarked", Value: false}},
+	}}}
+	// The emails are not needed to finish a run
+	findOptions := options.Find().SetProjection(bson.D{{Key: "html", Value: 0}, {Key: "text", Value: 0}})
+	cursor, err := db.FindMany(client, "apps", "digests", filter, findOptions)
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), REQUEST_TIMEOUT)
+	defer cancel()
+	defer cursor.Close(ctx)
+
+	var records []Record
+	if err := cursor.All(ctx, &records); err != nil {
+		return 0, err
+	}
+	for i, record := range records {
+		messageIDs := record.MessageIDs
+		recorded := true
+		if record.Status == StatusSending {
+			var sent db.SentMessage
+			err := db.FindOne(client, "apps", "sent", bson.D{{Key: "_id", Value: record.Id}}, &sent)
+			if err == mongo.ErrNoDocuments {
+				recorded = false
+			} else if err != nil {
+				return i, err
+			}
+			messageIDs = sent.MessageIDs
+		}
+		if reconcileStatus(record, recorded) == StatusUnconfirmed {
+			fmt.Printf("Digest %s stopped while sending and may not have gone out, check Mailjet\n", record.Id.Hex())
+			if err := MarkUnconfirmed(client, record); err != nil {
+				return i, err
+			}
+			continue
+		}
+		if err := MarkSent(client, record, messageIDs); err != nil {
+			return i, err
+		}
+	}
+	return len(records), nil
+}
+
+// Get sent digests, newest first, without their emails
+func SentRecords(client *mongo.Client, limit int64, skip int64) ([]Record, error) {
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{Key: "sentAt", Value: -1}})
+	findOptions.SetLimit(limit)
+	findOptions.SetSkip(skip)
+	findOptions.SetProjection(bson.D{{Key: "html", Value: 0}, {Key: "text", Value: 0}})
+	cursor, err := db.FindMany(client, "apps", "digests", bson.D{{Key: "status", Value: StatusSent}}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), REQUEST_TIMEOUT)
+	defer cancel()
+	defer cursor.Close(ctx)
+
+	records := []Record{}
+	err = cursor.All(ctx, &records)
+	return records, err
+}
+
+// Get a sent digest along with its emails
+func SentRecord(client *mongo.Client, id primitive.ObjectID) (Record, error) {
+	var record Record
+	filter := bson.D{{Key: "_id", Value: id}, {Key: "status", Value: StatusSent}}
+	err := db.FindOne(client, "apps", "digests", filter, &record)
+	return record, err
+}
@@ -0,0 +1,27 @@
+// Package format formats Hoagie Stuff posts for emails
+package format
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+)
+
+var tagPattern = regexp.MustCompile(`<[^>]*>`)
+
+// Returns a price in cents as shown to users, such as "$12.50" or "Free"
+func Price(cents int64) string {
+	if cents == 0 {
+		return "Free"
+	}
+	if cents%100 == 0 {
+		return fmt.Sprintf("$%d", cents/100)
+	}
+	return fmt.Sprintf("$%d.%02d", cents/100, cents%100)
+}
+
+// Returns the text of a description without any tags, which older posts
+// may include, for plain text emails and searching
+func PlainText(text string) string {
+	return html.UnescapeString(tagPattern.ReplaceAllString(text, " "))
+}
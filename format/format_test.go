@@ -0,0 +1,37 @@
+package format
+
+import "testing"
+
+func TestPrice(t *testing.T) {
+	tests := []struct {
+		cents int64
+		want  string
+	}{
+		{0, "Free"},
+		{5, "$0.05"},
+		{1200, "$12"},
+		{1250, "$12.50"},
+		{100000, "$1000"},
+	}
+	for _, test := range tests {
+		if got := Price(test.cents); got != test.want {
+			t.Errorf("Price(%d) = %q, want %q", test.cents, got, test.want)
+		}
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Blue water bottle", "Blue water bottle"},
+		{"<p>Blue</p><p>bottle</p>", " Blue  bottle "},
+		{"Tom &amp; Jerry", "Tom & Jerry"},
+	}
+	for _, test := range tests {
+		if got := PlainText(test.text); got != test.want {
+			t.Errorf("PlainText(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
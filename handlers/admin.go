@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"hoagie-profile/config"
+	"hoagie-profile/db"
+	"hoagie-profile/digest"
+	"hoagie-profile/response"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const maxAnnouncementTitleChars = 100
+
+// GET /admin/digest/config
+var digestConfigHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	if _, success := getAdmin(w, r.Header.Get("authorization"), "You do not have access to the digest settings."); !success {
+		return
+	}
+
+	digestConfig, err := config.LoadDigest(client)
+	if err != nil {
+		response.Write(w, response.Internal(err))
+		return
+	}
+	response.JSON(w, http.StatusOK, digestConfig)
+})
+
+// PUT /admin/digest/config
+var digestConfigUpdateHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	admin, success := getAdmin(w, r.Header.Get("authorization"), "You do not have access to the digest settings.")
+	if !success {
+		return
+	}
+
+	var digestConfig config.Digest
+	if err := json.NewDecoder(r.Body).Decode(&digestConfig); err != nil {
+		response.Write(w, response.BadRequest("Settings did not contain correct fields."))
+		return
+	}
+	// The intros are emailed to every listserv
+	p.AllowStyles(SAFE_CSS_PROPERTIES...).Globally()
+	digestConfig.Intro = p.Sanitize(digestConfig.Intro)
+	digestConfig.SummerIntro = p.Sanitize(digestConfig.SummerIntro)
+	if digestConfig.Summer == nil {
+		digestConfig.Summer = []config.DateRange{}
+	}
+	if digestConfig.SectionOrder == nil {
+		digestConfig.SectionOrder = []string{}
+	}
+	if digestConfig.PriorityTags == nil {
+		digestConfig.PriorityTags = []string{}
+	}
+	if digestConfig.PostOrder == "" {
+		digestConfig.PostOrder = config.OrderCreated
+	}
+	if err := digestConfig.Validate(); err != nil {
+		response.Write(w, response.Invalid("settings", fmt.Sprintf("Invalid digest settings: %s.", err.Error())))
+		return
+	}
+
+	if err := config.SaveDigest(client, digestConfig); err != nil {
+		response.Write(w, response.Internal(err))
+		return
+	}
+	fmt.Printf("DIGEST: %s updated the digest settings.\n", admin.Email)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte("{\"Status\": \"OK\"}"))
+})
+
+// GET /admin/digest/preview renders the next digest from the posts that have
+// not been sent yet, without sending it. Pass format=html to get the email itself.
+var digestPreviewHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	if _, success := getAdmin(w, r.Header.Get("authorization"), "You do not have access to the digest settings."); !success {
+		return
+	}
+
+	nextDigest, digestConfig, err := digest.Next(client, time.Now())
+	if err != nil {
+		response.Write(w, response.Internal(err))
+		return
+	}
+	preview, err := nextDigest.Preview(digestConfig)
+	if err != nil {
+		response.Write(w, response.Internal(fmt.Errorf("rendering digest: %s", err)))
+		return
+	}
+
+	if r.URL.Query().Get("format") == "html" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(preview.HTML))
+		return
+	}
+	response.JSON(w, http.StatusOK, preview)
+})
+
+// GET /admin/digest/announcements
+var announcementsHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	if _, success := getAdmin(w, r.Header.Get("authorization"), "You do not have access to digest announcements."); !success {
+		return
+	}
+
+	announcements, err := digest.AllAnnouncements(client)
+	if err != nil {
+		response.Write(w, response.Internal(err))
+		return
+	}
+	response.JSON(w, http.StatusOK, announcements)
+})
+
+// POST /admin/digest/announcements pins an announcement above every section
+// of the digests sent until it ends
+var announcementCreateHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	admin, success := getAdmin(w, r.Header.Get("authorization"), "You do not have access to digest announcements.")
+	if !success {
+		return
+	}
+
+	var announcementReq digest.Announcement
+	if err := json.NewDecoder(r.Body).Decode(&announcementReq); err != nil {
+		response.Write(w, response.BadRequest("Announcement did not contain correct fields."))
+		return
+	}
+	announcementReq.Title = strings.TrimSpace(announcementReq.Title)
+	titleLength := utf8.RuneCountInString(announcementReq.Title)
+	if titleLength < 1 || titleLength > maxAnnouncementTitleChars {
+		response.Write(w, response.Invalid("title", fmt.Sprintf("Title needs to be between 1 and %d characters inclusive.", maxAnnouncementTitleChars)))
+		return
+	}
+	// The announcement is emailed to every listserv
+	p.AllowStyles(SAFE_CSS_PROPERTIES...).Globally()
+	announcementReq.Body = p.Sanitize(announcementReq.Body)
+	if strings.TrimSpace(announcementReq.Body) == "" {
+		response.Write(w, response.Invalid("body", "Announcement needs a body."))
+		return
+	}
+	if announcementReq.Link != "" && !strings.HasPrefix(announcementReq.Link, "https://") {
+		response.Write(w, response.Invalid("link", "Announcement link needs to start with https://."))
+		return
+	}
+	if announcementReq.StartsAt.IsZero() {
+		announcementReq.StartsAt = time.Now()
+	}
+	if !announcementReq.EndsAt.After(announcementReq.StartsAt) {
+		response.Write(w, response.Invalid("endsAt", "Announcement needs to end after it starts."))
+		return
+	}
+
+	announcementId := primitive.NewObjectID()
+	_, err := db.InsertOne(client, "apps", "announcements", bson.D{
+		{Key: "_id", Value: announcementId},
+		{Key: "title", Value: announcementReq.Title},
+		{Key: "body", Value: announcementReq.Body},
+		{Key: "link", Value: announcementReq.Link},
+		{Key: "startsAt", Value: announcementReq.StartsAt},
+		{Key: "endsAt", Value: announcementReq.EndsAt},
+		{Key: "createdBy", Value: admin.Email},
+		{Key: "createdAt", Value: time.Now()},
+	})
+	if err != nil {
+		response.Write(w, response.Internal(err))
+		return
+	}
+	fmt.Printf("DIGEST: %s pinned the announcement %s.\n", admin.Email, announcementId.Hex())
+	w.Header().Set("Content-Type", "application/json")
+	jsonResp, _ := json.Marshal(map[string]string{"Status": "OK", "id": announcementId.Hex()})
+	w.Write(jsonResp)
+})
+
+// DELETE /admin/digest/announcements/{id}
+var announcementDeleteHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	admin, success := getAdmin(w, r.Header.Get("authorization"), "You do not have access to digest announcements.")
+	if !success {
+		return
+	}
+
+	announcementId, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		response.Write(w, response.NotFound("Could not find the specified announcement. Try refreshing the page."))
+		return
+	}
+	deleteResult, err := db.DeleteOne(client, "apps", "announcements", bson.D{{Key: "_id", Value: announcementId}})
+	if err != nil {
+		response.Write(w, response.Internal(err))
+		return
+	}
+	if deleteResult.DeletedCount < 1 {
+		response.Write(w, response.NotFound("Could not find the specified announcement. Try refreshing the page."))
+		return
+	}
+	fmt.Printf("DIGEST: %s removed the announcement %s.\n", admin.Email, announcementId.Hex())
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte("{\"Status\": \"OK\"}"))
+})
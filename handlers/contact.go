@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"hoagie-profile/db"
+	"hoagie-profile/mail"
+	"hoagie-profile/response"
+	"html"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ContactRequest struct {
+	Message string `json:"message"`
+}
+
+// Limits for contact messages
+const (
+	minContactChars = 10
+	maxContactChars = 1000
+)
+
+// Get any post by its ID
+func getPost(id string) (PostData, error) {
+	postId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return PostData{}, fmt.Errorf("invalid post ID: %s", id)
+	}
+	var response PostData
+	err = db.FindOne(client, "apps", "stuff", bson.D{{Key: "_id", Value: postId}}, &response)
+	if err != nil {
+		return PostData{}, fmt.Errorf("error getting post: %s", err)
+	}
+	return response, nil
+}
+
+// Builds the email relayed to the poster. The message is plain text, so
+// it is escaped rather than sanitized.
+func contactMessage(post PostData, fromName string, fromEmail string, message string) mail.Message {
+	intro := fmt.Sprintf("%s sent you a message about your Hoagie Stuff post \"%s\":", fromName, post.Title)
+	footer := "Reply to this email to respond. Your reply goes directly to them and includes your email address."
+	quoted := strings.ReplaceAll(html.EscapeString(message), "\n", "<br />")
+
+	var body strings.Builder
+	body.WriteString(`<div style="font-family: sans-serif;">`)
+	body.WriteString(fmt.Sprintf("<p>%s</p>", html.EscapeString(intro)))
+	body.WriteString(fmt.Sprintf(`<blockquote style="border-left: 3px solid #edeff5; margin: 10px 0px; padding-left: 10px;">%s</blockquote>`, quoted))
+	unsubscribeURL := mail.UnsubscribeURL(post.Email, mail.ListContact)
+	body.WriteString(fmt.Sprintf(`<p style="font-size:8pt;">%s <a target="_blank" href="%s">Stop getting messages about your posts</a></p></div>`,
+		footer, html.EscapeString(unsubscribeURL)))
+
+	return mail.Message{
+		To:          post.Email,
+		ToName:      post.User.Name,
+		ReplyTo:     fromEmail,
+		ReplyToName: fromName,
+		Subject:     fmt.Sprintf("💬 Message about your post: %s", post.Title),
+		HTML:        body.String(),
+		Text:        fmt.Sprintf("%s\n\n%s\n\n%s\nStop getting messages about your posts: %s\n", intro, message, footer, unsubscribeURL),
+		CustomID:    "stuff-contact",
+		List:        mail.ListContact,
+	}
+}
+
+// POST /stuff/{id}/contact
+var stuffContactHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	user, success := getUser(r.Header.Get("authorization"))
+	if !success {
+		response.Write(w, response.Unauthorized("You do not have access to contact posters."))
+		return
+	}
+
+	var contactReq ContactRequest
+	if err := json.NewDecoder(r.Body).Decode(&contactReq); err != nil {
+		response.Write(w, response.BadRequest("Message did not contain correct fields."))
+		return
+	}
+	contactReq.Message = strings.TrimSpace(contactReq.Message)
+	length := utf8.RuneCountInString(contactReq.Message)
+	if length < minContactChars || length > maxContactChars {
+		response.Write(w, response.Invalid("message", fmt.Sprintf("Message needs to be between %d and %d characters inclusive.", minContactChars, maxContactChars)))
+		return
+	}
+
+	post, err := getPost(mux.Vars(r)["id"])
+	if err != nil || post.currentState() != stateActive || post.Hidden {
+		response.Write(w, response.NotFound("Could not find the specified post. It may have been resolved or expired."))
+		return
+	}
+	if post.Email == user.Email {
+		response.Write(w, response.Forbidden("You cannot contact yourself about your own post."))
+		return
+	}
+	// The message would not be sent, so tell the buyer instead
+	preferences, err := mail.GetPreferences(client, post.Email)
+	if err != nil {
+		response.Write(w, response.Internal(err))
+		return
+	}
+	if preferences.IsUnsubscribed(mail.ListContact) {
+		response.Write(w, response.Forbidden("The poster does not accept messages through Hoagie Stuff."))
+		return
+	}
+
+	// Ignore user limits when debugging
+	if os.Getenv("HOAGIE_MODE") != "debug" && !getContactLimiter(user.Email).Allow() {
+		response.Write(w, response.TooManyRequests("You have reached your contact limit. "+
+			"You can send up to 5 messages, then one more every 12 minutes."))
+		return
+	}
+
+	err = mail.Send(client, "Hoagie Stuff", []mail.Message{contactMessage(post, user.Name, user.Email, contactReq.Message)})
+	if err != nil {
+		response.Write(w, response.Internal(err))
+		return
+	}
+
+	// Kept so that abusive messages can be traced back to their sender
+	db.InsertOne(client, "apps", "contacts", bson.D{
+		{Key: "postId", Value: post.objectId()},
+		{Key: "from", Value: user.Email},
+		{Key: "to", Value: post.Email},
+		{Key: "createdAt", Value: time.Now()},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte("{\"Status\": \"OK\"}"))
+})
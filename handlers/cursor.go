@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hoagie-profile/db"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Position of a post in the feed, which is ordered by createdAt and then
+// by _id so that posts created at the same time keep a stable order
+type stuffCursor struct {
+	CreatedAt time.Time          `json:"t"`
+	Id        primitive.ObjectID `json:"id"`
+}
+
+// A page of posts returned by GET /stuff when paginating with cursors
+type StuffPage struct {
+	Posts []PostData `json:"posts"`
+	// Opaque token to pass as the cursor parameter for the next page
+	NextCursor string `json:"nextCursor"`
+	HasMore    bool   `json:"hasMore"`
+	// Number of posts matching the filters across all pages
+	Total int64 `json:"total"`
+}
+
+func encodeStuffCursor(post PostData) string {
+	token, _ := json.Marshal(stuffCursor{CreatedAt: post.CreatedAt, Id: post.objectId()})
+	return base64.RawURLEncoding.EncodeToString(token)
+}
+
+func decodeStuffCursor(token string) (stuffCursor, error) {
+	var cursor stuffCursor
+	decoded, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return cursor, fmt.Errorf("invalid cursor")
+	}
+	if err := json.Unmarshal(decoded, &cursor); err != nil || cursor.Id.IsZero() {
+		return cursor, fmt.Errorf("invalid cursor")
+	}
+	return cursor, nil
+}
+
+// Filter for the posts that come after the cursor in the feed. The $or is
+// wrapped in an $and so it does not clash with other $or conditions.
+func (cursor stuffCursor) filter() bson.E {
+	return bson.E{Key: "$and", Value: bson.A{
+		bson.D{{Key: "$or", Value: bson.A{
+			bson.D{{Key: "createdAt", Value: bson.D{{Key: "$lt", Value: cursor.CreatedAt}}}},
+			bson.D{
+				{Key: "createdAt", Value: cursor.CreatedAt},
+				{Key: "_id", Value: bson.D{{Key: "$lt", Value: cursor.Id}}},
+			},
+		}}},
+	}}
+}
+
+// Get a page of posts, newest first. Unlike offsets, cursors are not
+// shifted by new posts, so pages never repeat or skip posts. Search
+// results are ordered by date rather than relevance when paginating.
+var getStuffPage = func(stuffQuery StuffQuery) (StuffPage, error) {
+	page := StuffPage{Posts: []PostData{}}
+	query := stuffQuery.filter()
+
+	total, err := db.CountDocuments(client, "apps", "stuff", query)
+	if err != nil {
+		return page, fmt.Errorf("Error counting stuff in database: %s", err)
+	}
+	page.Total = total
+
+	if stuffQuery.After != nil {
+		query = append(query, stuffQuery.After.filter())
+	}
+
+	// Fetch one extra post to know whether there is a next page
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{
+		{Key: "createdAt", Value: -1},
+		{Key: "_id", Value: -1},
+	})
+	findOptions.SetLimit(stuffQuery.Limit + 1)
+
+	resultCursor, err := db.FindMany(client, "apps", "stuff", query, findOptions)
+	if err != nil {
+		return page, fmt.Errorf("Error getting stuff from database: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), REQUEST_TIMEOUT)
+	defer cancel()
+	defer resultCursor.Close(ctx)
+
+	if err := resultCursor.All(ctx, &page.Posts); err != nil {
+		return page, fmt.Errorf("Error getting stuff: %s", err)
+	}
+
+	if int64(len(page.Posts)) > stuffQuery.Limit {
+		page.Posts = page.Posts[:stuffQuery.Limit]
+		page.HasMore = true
+	}
+	if page.HasMore && len(page.Posts) > 0 {
+		page.NextCursor = encodeStuffCursor(page.Posts[len(page.Posts)-1])
+	}
+	return page, nil
+}
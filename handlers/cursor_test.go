@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestStuffCursorRoundTrip(t *testing.T) {
+	createdAt := time.Date(2024, time.March, 5, 17, 30, 15, 250_000_000, time.UTC)
+	post := PostData{Id: primitive.NewObjectID().Hex(), CreatedAt: createdAt}
+
+	cursor, err := decodeStuffCursor(encodeStuffCursor(post))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cursor.CreatedAt.Equal(createdAt) {
+		t.Errorf("createdAt = %s, want %s", cursor.CreatedAt, createdAt)
+	}
+	if cursor.Id.Hex() != post.Id {
+		t.Errorf("id = %s, want %s", cursor.Id.Hex(), post.Id)
+	}
+}
+
+func TestStuffCursorRejectsTampering(t *testing.T) {
+	valid := encodeStuffCursor(PostData{Id: primitive.NewObjectID().Hex(), CreatedAt: time.Now()})
+	encode := func(token string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(token))
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"empty", ""},
+		{"truncated", valid[:len(valid)/2]},
+		{"not base64", "not a cursor!"},
+		{"not JSON", encode("cursor")},
+		{"missing ID", encode(`{"t":"2024-03-05T17:00:00Z"}`)},
+		{"invalid ID", encode(`{"t":"2024-03-05T17:00:00Z","id":"zzz"}`)},
+		{"invalid time", encode(`{"t":"yesterday","id":"65e74c3f0000000000000000"}`)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := decodeStuffCursor(test.token); err == nil {
+				t.Errorf("decodeStuffCursor(%q) succeeded, want an error", test.token)
+			}
+		})
+	}
+}
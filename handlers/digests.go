@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"hoagie-profile/digest"
+	"hoagie-profile/response"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Page sizes of the digest archive
+const (
+	defaultDigestsLimit = 20
+	maxDigestsLimit     = 100
+)
+
+// GET /digests lists the sent digests, newest first, without their emails
+var digestsHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	limit := int64(defaultDigestsLimit)
+	if value := values.Get("limit"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 1 || parsed > maxDigestsLimit {
+			response.Write(w, response.Invalid("limit", "Invalid query: invalid limit."))
+			return
+		}
+		limit = parsed
+	}
+	var offset int64
+	if value := values.Get("offset"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 0 {
+			response.Write(w, response.Invalid("offset", "Invalid query: invalid offset."))
+			return
+		}
+		offset = parsed
+	}
+
+	records, err := digest.SentRecords(client, limit, offset)
+	if err != nil {
+		response.Write(w, response.Internal(err))
+		return
+	}
+	response.JSON(w, http.StatusOK, records)
+})
+
+// GET /digests/{id} returns a sent digest with its emails. Pass format=html
+// or format=text to get the email itself.
+var digestHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	digestId, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		response.Write(w, response.NotFound("Could not find the specified digest."))
+		return
+	}
+	record, err := digest.SentRecord(client, digestId)
+	if err == mongo.ErrNoDocuments {
+		response.Write(w, response.NotFound("Could not find the specified digest."))
+		return
+	} else if err != nil {
+		response.Write(w, response.Internal(err))
+		return
+	}
+
+	switch r.URL.Query().Get("format") {
+	case "html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(record.HTML))
+		return
+	case "text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(record.Text))
+		return
+	}
+	response.JSON(w, http.StatusOK, record)
+})
@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"hoagie-profile/db"
+	"hoagie-profile/response"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Event callback sent by Mailjet, see https://dev.mailjet.com/email/guides/webhooks/
+type MailEvent struct {
+	Event          string `json:"event"`
+	Time           int64  `json:"time"`
+	MessageID      int64  `json:"MessageID"`
+	Email          string `json:"email"`
+	CustomID       string `json:"CustomID"`
+	Payload        string `json:"Payload"`
+	URL            string `json:"url"`
+	Error          string `json:"error"`
+	ErrorRelatedTo string `json:"error_related_to"`
+}
+
+type UserSentMail struct {
+	Status string           `json:"status"`
+	Mail   []db.SentMessage `json:"sentMail"`
+}
+
+// Events that are counted in the delivery stats of a sent message
+var mailEventTypes = map[string]bool{
+	"sent":    true,
+	"bounce":  true,
+	"blocked": true,
+	"spam":    true,
+	"open":    true,
+	"click":   true,
+}
+
+// Events that mean a recipient did not accept the message
+var mailFailureTypes = map[string]bool{
+	"bounce":  true,
+	"blocked": true,
+	"spam":    true,
+}
+
+// Number of sent messages returned to the sender
+const sentMailLimit = 20
+
+// Returns true if the request carries the shared webhook secret, either as
+// the basic auth password configured in Mailjet or in the webhook secret
+// header. Query parameters are not accepted, since URLs end up in logs.
+func webhookAuthorized(r *http.Request) bool {
+	secret := os.Getenv("MAILJET_WEBHOOK_SECRET")
+	if secret == "" {
+		return false
+	}
+	provided := r.Header.Get("X-Webhook-Secret")
+	if _, password, ok := r.BasicAuth(); ok {
+		provided = password
+	}
+	return subtle.ConstantTimeCompare([]byte(provided), []byte(secret)) == 1
+}
+
+// Mailjet sends either a single event or, with grouping enabled, an array of events
+func decodeMailEvents(body []byte) ([]MailEvent, error) {
+	var events []MailEvent
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		err := json.Unmarshal(body, &events)
+		return events, err
+	}
+	var event MailEvent
+	err := json.Unmarshal(body, &event)
+	return []MailEvent{event}, err
+}
+
+// Mailjet event as stored in apps.mail_events
+type StoredMailEvent struct {
+	Id        primitive.ObjectID `bson:"_id"`
+	MessageID int64              `bson:"messageId"`
+	Event     string             `bson:"event"`
+	Time      time.Time          `bson:"time"`
+	Email     string             `bson:"email"`
+	Payload   string             `bson:"payload"`
+	Error     string             `bson:"error"`
+	// Set once the event is counted in the stats of its sent message
+	Counted bool `bson:"counted"`
+}
+
+// How often, and for how long after they arrive, events that could not be
+// counted yet are tried again
+const (
+	mailEventRetryInterval = 10 * time.Minute
+	mailEventRetryWindow   = 24 * time.Hour
+)
+
+// Store a delivery event and apply it to the sent message it belongs to.
+// Mailjet retries callbacks that time out, so events are stored once per
+// message, event and time, and each event is marked once it is counted.
+// A retry of an event that was stored but not counted counts it.
+func recordMailEvent(event MailEvent) error {
+	key := bson.D{
+		{Key: "messageId", Value: event.MessageID},
+		{Key: "event", Value: event.Event},
+		{Key: "time", Value: time.Unix(event.Time, 0)},
+	}
+	_, err := db.UpsertOne(client, "apps", "mail_events", key,
+		bson.D{{Key: "$setOnInsert", Value: bson.D{
+			{Key: "email", Value: event.Email},
+			{Key: "customId", Value: event.CustomID},
+			{Key: "payload", Value: event.Payload},
+			{Key: "url", Value: event.URL},
+			{Key: "error", Value: event.Error},
+			{Key: "errorRelatedTo", Value: event.ErrorRelatedTo},
+			// Events without stats have nothing to count
+			{Key: "counted", Value: !mailEventTypes[event.Event]},
+			{Key: "createdAt", Value: time.Now()},
+		}}},
+	)
+	// A retry stored at the same time as the original hits the unique index
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+
+	var stored StoredMailEvent
+	err = db.FindOne(client, "apps", "mail_events", append(key, bson.E{Key: "counted", Value: false}), &stored)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return countMailEvent(stored)
+}
+
+// Applies a stored event to the stats of its sent message and marks it as
+// counted. Events of messages that are not recorded yet are left uncounted.
+func countMailEvent(event StoredMailEvent) error {
+	// Messages are tagged with the ID of their sent record; fall back
+	// to the Mailjet message ID for anything sent without a payload
+	filter := bson.D{{Key: "messageIds", Value: event.MessageID}}
+	if sentId, err := primitive.ObjectIDFromHex(event.Payload); err == nil {
+		filter = bson.D{{Key: "_id", Value: sentId}}
+	}
+	update := bson.D{{Key: "$inc", Value: bson.D{{Key: "stats." + event.Event, Value: 1}}}}
+	if mailFailureTypes[event.Event] {
+		failure := db.DeliveryFailure{
+			Email: event.Email,
+			Event: event.Event,
+			Error: event.Error,
+			Time:  event.Time,
+		}
+		update = append(update, bson.E{Key: "$push", Value: bson.D{{Key: "failures", Value: failure}}})
+	}
+	result, err := db.UpdateOne(client, "apps", "sent", filter, update)
+	if err != nil || result.MatchedCount == 0 {
+		return err
+	}
+	_, err = db.UpdateOne(client, "apps", "mail_events",
+		bson.D{{Key: "_id", Value: event.Id}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "counted", Value: true}}}},
+	)
+	return err
+}
+
+// Every few minutes, count the recent events that arrived before their
+// sent message was recorded or whose count failed
+func retryMailEvents() {
+	for {
+		time.Sleep(mailEventRetryInterval)
+		if err := countPendingMailEvents(time.Now().Add(-mailEventRetryWindow)); err != nil {
+			fmt.Printf("[!] Error counting mail events: %s\n", err)
+		}
+	}
+}
+
+func countPendingMailEvents(since time.Time) error {
+	cursor, err := db.FindMany(client, "apps", "mail_events", bson.D{
+		{Key: "counted", Value: false},
+		{Key: "createdAt", Value: bson.D{{Key: "$gt", Value: since}}},
+	}, options.Find())
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), REQUEST_TIMEOUT)
+	defer cancel()
+	defer cursor.Close(ctx)
+
+	var events []StoredMailEvent
+	if err := cursor.All(ctx, &events); err != nil {
+		return err
+	}
+	for _, event := range events {
+		if err := countMailEvent(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get the most recent sent messages of a given user
+func getAllSent(email string) ([]db.SentMessage, error) {
+	var responses []db.SentMessage
+
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	findOptions.SetLimit(sentMailLimit)
+
+	resultCursor, err := db.FindMany(client, "apps", "sent", bson.D{{Key: "email", Value: email}}, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("error querying sent mail: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), REQUEST_TIMEOUT)
+	defer cancel()
+	defer resultCursor.Close(ctx)
+
+	if err := resultCursor.All(ctx, &responses); err != nil {
+		return nil, fmt.Errorf("error decoding sent mail: %s", err)
+	}
+	return responses, nil
+}
+
+// POST /mail/events
+var mailEventsHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	if !webhookAuthorized(r) {
+		response.Write(w, response.Unauthorized("Invalid webhook secret."))
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		response.Write(w, response.BadRequest("Could not read event body."))
+		return
+	}
+	events, err := decodeMailEvents(body)
+	if err != nil {
+		response.Write(w, response.BadRequest("Event did not contain correct fields."))
+		return
+	}
+
+	// Mailjet retries any callback that is not answered with a 200,
+	// so only storage failures are reported back
+	for _, event := range events {
+		if err := recordMailEvent(event); err != nil {
+			response.Write(w, response.Internal(fmt.Errorf("recording event: %s", err)))
+			return
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+})
+
+// GET /mail/sent/user
+var sentUserHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	user, success := getUser(r.Header.Get("authorization"))
+	if !success {
+		response.Write(w, response.Unauthorized("You do not have access to view sent mail."))
+		return
+	}
+	sentMail, err := getAllSent(user.Email)
+	if err != nil {
+		response.Write(w, response.Internal(err))
+		return
+	}
+	userSentMail := UserSentMail{Status: "unused", Mail: sentMail}
+	if len(sentMail) > 0 {
+		userSentMail.Status = "used"
+	}
+
+	response.JSON(w, http.StatusOK, userSentMail)
+})
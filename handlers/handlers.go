@@ -1,6 +1,10 @@
 package handlers
 
 import (
+	"fmt"
+	"hoagie-profile/config"
+	"hoagie-profile/db"
+	"hoagie-profile/response"
 	"time"
 
 	jwtmiddleware "github.com/auth0/go-jwt-middleware"
@@ -10,41 +14,159 @@ import (
 
 var REQUEST_TIMEOUT = 10 * time.Second
 
-// Delete Stuff information every week
-var EXPIRATION_DURATION = 60 * 60 * 24 * 10
+// Expiration of Stuff posts created before posts had their own expiration
+var EXPIRATION_DURATION = int(config.LegacyExpiration / time.Second)
 var client *mongo.Client
 
 const (
-	mailRoute              = "/mail"
-	mailSendRoute          = "/mail/send/"
-	mailScheduledUserRoute = "/mail/scheduled/user/"
-	stuffRoute             = "/stuff/"
-	stuffUserRoute         = "/stuff/user/"
+	mailRoute               = "/mail"
+	mailSendRoute           = "/mail/send/"
+	mailScheduledUserRoute  = "/mail/scheduled/user/"
+	mailSentUserRoute       = "/mail/sent/user/"
+	mailEventsRoute         = "/mail/events/"
+	stuffRoute              = "/stuff/"
+	stuffUserRoute          = "/stuff/user/"
+	stuffUserPostRoute      = "/stuff/user/{id}/"
+	stuffUserResolveRoute   = "/stuff/user/{id}/resolve/"
+	stuffImagesRoute        = "/stuff/images/"
+	stuffImageRoute         = "/stuff/images/{id}/"
+	stuffImageThumbRoute    = "/stuff/images/{id}/thumbnail/"
+	stuffContactRoute       = "/stuff/{id}/contact/"
+	stuffReportRoute        = "/stuff/{id}/report/"
+	stuffTaxonomyRoute      = "/stuff/taxonomy/"
+	adminTaxonomyRoute      = "/admin/stuff/taxonomy/"
+	adminReportsRoute       = "/admin/stuff/reports/"
+	adminStuffPostRoute     = "/admin/stuff/{id}/"
+	adminStuffHideRoute     = "/admin/stuff/{id}/hide/"
+	adminStuffRestoreRoute  = "/admin/stuff/{id}/restore/"
+	adminDigestConfigRoute  = "/admin/digest/config/"
+	adminDigestPreviewRoute = "/admin/digest/preview/"
+	adminAnnouncementsRoute = "/admin/digest/announcements/"
+	adminAnnouncementRoute  = "/admin/digest/announcements/{id}/"
+	stuffSearchesRoute      = "/stuff/searches/"
+	stuffSearchRoute        = "/stuff/searches/{id}/"
+	digestsRoute            = "/digests/"
+	digestRoute             = "/digests/{id}/"
+	subscriptionRoute       = "/digest/subscription/"
+	unsubscribeRoute        = "/unsubscribe/"
+	preferencesRoute        = "/preferences/"
 )
 
 func Setup(r *mux.Router, cl *mongo.Client, m *jwtmiddleware.JWTMiddleware) {
 	client = cl
-	setupStuffIndex()
+
+	// Pending migrations are applied before the handlers, which only read
+	// the migrated fields, start serving requests
+	migrations, err := db.MigrateUp(client, "apps", db.AppsMigrations, 0, false)
+	for _, migration := range migrations {
+		fmt.Printf("[i] Applied migration %s\n", migration)
+	}
+	if err != nil {
+		panic("Error applying migrations " + err.Error())
+	}
+
+	// Indexes are synced rather than recreated, so indexes added by hand survive restarts
+	changes, err := db.SyncIndexes(client, "apps", db.AppsIndexes, false)
+	for _, change := range changes {
+		fmt.Printf("[i] Index change: %s\n", change)
+	}
+	if err != nil {
+		fmt.Printf("[!] Error syncing indexes: %s\n", err)
+	}
+
+	if err := setupImageStore(); err != nil {
+		fmt.Printf("[!] Error setting up image storage: %s\n", err)
+	}
+
+	go retryMailEvents()
+
+	// Panics of any handler are answered with an internal error
+	r.Use(response.Recover)
+
+	// Mailjet webhooks authenticate with a shared secret instead of a JWT
+	r.Handle(mailEventsRoute, mailEventsHandler).Methods("POST")
+	// Images are linked from emails, which cannot send a JWT
+	r.Handle(stuffImageRoute, imageServeHandler(false)).Methods("GET")
+	r.Handle(stuffImageThumbRoute, imageServeHandler(true)).Methods("GET")
+	// Unsubscribe links are opened from emails and signed instead
+	r.Handle(unsubscribeRoute, unsubscribePageHandler).Methods("GET")
+	r.Handle(unsubscribeRoute, unsubscribeHandler).Methods("POST")
 
 	if m == nil {
 		r.Handle(mailSendRoute, sendHandler).Methods("POST")
 		r.Handle(stuffUserRoute, stuffSendHandler).Methods("POST")
 		r.Handle(stuffUserRoute, stuffUserHandler).Methods("GET")
-		r.Handle(stuffUserRoute, stuffDeleteHandler).Methods("DELETE")
+		r.Handle(stuffUserPostRoute, stuffEditHandler).Methods("PUT", "PATCH")
+		r.Handle(stuffUserPostRoute, stuffDeleteHandler).Methods("DELETE")
+		r.Handle(stuffUserResolveRoute, stuffResolveHandler).Methods("POST")
+		r.Handle(stuffImagesRoute, imageUploadHandler).Methods("POST")
 		r.Handle(stuffRoute, stuffAllHandler).Methods("GET")
+		r.Handle(stuffContactRoute, stuffContactHandler).Methods("POST")
+		r.Handle(stuffReportRoute, stuffReportHandler).Methods("POST")
+		r.Handle(stuffTaxonomyRoute, stuffTaxonomyHandler).Methods("GET")
+		r.Handle(adminTaxonomyRoute, taxonomyUpdateHandler).Methods("PUT")
+		r.Handle(adminReportsRoute, moderationQueueHandler).Methods("GET")
+		r.Handle(adminStuffHideRoute, moderationHideHandler).Methods("POST")
+		r.Handle(adminStuffRestoreRoute, moderationRestoreHandler).Methods("POST")
+		r.Handle(adminStuffPostRoute, moderationDeleteHandler).Methods("DELETE")
+		r.Handle(adminDigestConfigRoute, digestConfigHandler).Methods("GET")
+		r.Handle(adminDigestConfigRoute, digestConfigUpdateHandler).Methods("PUT")
+		r.Handle(adminDigestPreviewRoute, digestPreviewHandler).Methods("GET")
+		r.Handle(adminAnnouncementsRoute, announcementsHandler).Methods("GET")
+		r.Handle(adminAnnouncementsRoute, announcementCreateHandler).Methods("POST")
+		r.Handle(adminAnnouncementRoute, announcementDeleteHandler).Methods("DELETE")
+		r.Handle(stuffSearchesRoute, searchSaveHandler).Methods("POST")
+		r.Handle(stuffSearchesRoute, searchesUserHandler).Methods("GET")
+		r.Handle(stuffSearchRoute, searchDeleteHandler).Methods("DELETE")
+		r.Handle(digestsRoute, digestsHandler).Methods("GET")
+		r.Handle(digestRoute, digestHandler).Methods("GET")
+		r.Handle(subscriptionRoute, subscriptionHandler).Methods("GET")
+		r.Handle(subscriptionRoute, subscriptionUpdateHandler).Methods("PUT")
+		r.Handle(subscriptionRoute, subscriptionDeleteHandler).Methods("DELETE")
+		r.Handle(preferencesRoute, preferencesHandler).Methods("GET")
+		r.Handle(preferencesRoute, preferencesUpdateHandler).Methods("PUT")
 		r.Handle(mailScheduledUserRoute, scheduledSendHandler).Methods("POST")
 		r.Handle(mailScheduledUserRoute, scheduledUserHandler).Methods("GET")
 		r.Handle(mailScheduledUserRoute, scheduledDeleteHandler).Methods("DELETE")
+		r.Handle(mailSentUserRoute, sentUserHandler).Methods("GET")
 		return
 	} else {
 		r.Handle(mailSendRoute, m.Handler(sendHandler)).Methods("POST")
 		r.Handle(stuffUserRoute, m.Handler(stuffSendHandler)).Methods("POST")
 		r.Handle(stuffUserRoute, m.Handler(stuffUserHandler)).Methods("GET")
-		r.Handle(stuffUserRoute, m.Handler(stuffDeleteHandler)).Methods("DELETE")
+		r.Handle(stuffUserPostRoute, m.Handler(stuffEditHandler)).Methods("PUT", "PATCH")
+		r.Handle(stuffUserPostRoute, m.Handler(stuffDeleteHandler)).Methods("DELETE")
+		r.Handle(stuffUserResolveRoute, m.Handler(stuffResolveHandler)).Methods("POST")
+		r.Handle(stuffImagesRoute, m.Handler(imageUploadHandler)).Methods("POST")
 		r.Handle(stuffRoute, m.Handler(stuffAllHandler)).Methods("GET")
+		r.Handle(stuffContactRoute, m.Handler(stuffContactHandler)).Methods("POST")
+		r.Handle(stuffReportRoute, m.Handler(stuffReportHandler)).Methods("POST")
+		r.Handle(stuffTaxonomyRoute, m.Handler(stuffTaxonomyHandler)).Methods("GET")
+		r.Handle(adminTaxonomyRoute, m.Handler(taxonomyUpdateHandler)).Methods("PUT")
+		r.Handle(adminReportsRoute, m.Handler(moderationQueueHandler)).Methods("GET")
+		r.Handle(adminStuffHideRoute, m.Handler(moderationHideHandler)).Methods("POST")
+		r.Handle(adminStuffRestoreRoute, m.Handler(moderationRestoreHandler)).Methods("POST")
+		r.Handle(adminStuffPostRoute, m.Handler(moderationDeleteHandler)).Methods("DELETE")
+		r.Handle(adminDigestConfigRoute, m.Handler(digestConfigHandler)).Methods("GET")
+		r.Handle(adminDigestConfigRoute, m.Handler(digestConfigUpdateHandler)).Methods("PUT")
+		r.Handle(adminDigestPreviewRoute, m.Handler(digestPreviewHandler)).Methods("GET")
+		r.Handle(adminAnnouncementsRoute, m.Handler(announcementsHandler)).Methods("GET")
+		r.Handle(adminAnnouncementsRoute, m.Handler(announcementCreateHandler)).Methods("POST")
+		r.Handle(adminAnnouncementRoute, m.Handler(announcementDeleteHandler)).Methods("DELETE")
+		r.Handle(stuffSearchesRoute, m.Handler(searchSaveHandler)).Methods("POST")
+		r.Handle(stuffSearchesRoute, m.Handler(searchesUserHandler)).Methods("GET")
+		r.Handle(stuffSearchRoute, m.Handler(searchDeleteHandler)).Methods("DELETE")
+		r.Handle(digestsRoute, m.Handler(digestsHandler)).Methods("GET")
+		r.Handle(digestRoute, m.Handler(digestHandler)).Methods("GET")
+		r.Handle(subscriptionRoute, m.Handler(subscriptionHandler)).Methods("GET")
+		r.Handle(subscriptionRoute, m.Handler(subscriptionUpdateHandler)).Methods("PUT")
+		r.Handle(subscriptionRoute, m.Handler(subscriptionDeleteHandler)).Methods("DELETE")
+		r.Handle(preferencesRoute, m.Handler(preferencesHandler)).Methods("GET")
+		r.Handle(preferencesRoute, m.Handler(preferencesUpdateHandler)).Methods("PUT")
 		r.Handle(mailScheduledUserRoute, m.Handler(scheduledSendHandler)).Methods("POST")
 		r.Handle(mailScheduledUserRoute, m.Handler(scheduledUserHandler)).Methods("GET")
 		r.Handle(mailScheduledUserRoute, m.Handler(scheduledDeleteHandler)).Methods("DELETE")
+		r.Handle(mailSentUserRoute, m.Handler(sentUserHandler)).Methods("GET")
 	}
 
 	// princeton_token, err := _refreshToken()
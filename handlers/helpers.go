@@ -2,7 +2,9 @@ package handlers
 
 import (
 	"hoagie-profile/auth"
-	//"os"
+	"hoagie-profile/response"
+	"net/http"
+	"os"
 	"strings"
 )
 
@@ -18,3 +20,30 @@ func getUser(authorizationHeader string) (user auth.User, success bool) {
 	}
 	return user, true
 }
+
+// Admins moderate Hoagie Stuff and manage settings. They are listed in
+// HOAGIE_ADMINS as comma-separated emails, so they cannot be changed through the API.
+func isAdmin(user auth.User) bool {
+	for _, email := range strings.Split(os.Getenv("HOAGIE_ADMINS"), ",") {
+		email = strings.TrimSpace(email)
+		if email != "" && strings.EqualFold(email, user.Email) {
+			return true
+		}
+	}
+	return false
+}
+
+// Gets the user of a request if they are an admin, writing 401 if they
+// are not logged in and 403 with the given message if they are not an admin
+func getAdmin(w http.ResponseWriter, authorizationHeader string, message string) (user auth.User, success bool) {
+	user, success = getUser(authorizationHeader)
+	if !success {
+		response.Write(w, response.Unauthorized(message))
+		return auth.User{}, false
+	}
+	if !isAdmin(user) {
+		response.Write(w, response.Forbidden(message))
+		return auth.User{}, false
+	}
+	return user, true
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/form3tech-oss/jwt-go"
+)
+
+func TestGetAdminStatus(t *testing.T) {
+	t.Setenv("HOAGIE_ADMINS", "admin@princeton.edu")
+	token := func(email string) string {
+		signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"https://hoagie.io/email": email,
+			"https://hoagie.io/name":  "Tiger",
+		}).SignedString([]byte("test"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "Bearer " + signed
+	}
+	tests := []struct {
+		name          string
+		authorization string
+		wantStatus    int
+		wantSuccess   bool
+	}{
+		{"missing token", "", http.StatusUnauthorized, false},
+		{"invalid token", "Bearer nonsense", http.StatusUnauthorized, false},
+		{"not an admin", token("tiger@princeton.edu"), http.StatusForbidden, false},
+		{"admin", token("admin@princeton.edu"), http.StatusOK, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			_, success := getAdmin(w, test.authorization, "You do not have access.")
+			if success != test.wantSuccess || w.Code != test.wantStatus {
+				t.Errorf("getAdmin = %v with status %d, want %v with %d", success, w.Code, test.wantSuccess, test.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,436 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hoagie-profile/db"
+	"hoagie-profile/response"
+	"hoagie-profile/storage"
+	"image"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Uploaded Stuff image; the blobs themselves live in imageStore
+type ImageData struct {
+	Id          string `json:"id" bson:"_id,omitempty"`
+	Email       string `json:"email" bson:"email"`
+	Key         string `json:"-" bson:"key"`
+	ThumbKey    string `json:"-" bson:"thumbKey"`
+	ContentType string `json:"contentType" bson:"contentType"`
+	Width       int    `json:"width" bson:"width"`
+	Height      int    `json:"height" bson:"height"`
+	// Bytes of the image and its thumbnail
+	Size      int64     `json:"size" bson:"size"`
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+}
+
+type ImageResponse struct {
+	Id           string `json:"id"`
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnailUrl"`
+}
+
+// Limits for uploaded images
+const (
+	maxImageBytes  = 5 << 20
+	maxImagePixels = 40_000_000
+	// Bytes of stored images each user may have at once
+	maxUserImageBytes = 50 << 20
+	// Longest side of the stored image and of its thumbnail
+	imageMaxSide     = 1600
+	thumbnailMaxSide = 400
+)
+
+// Accepted image types and the format they are stored in
+var imageFormats = map[string]string{
+	"image/jpeg": "jpeg",
+	"image/png":  "png",
+	"image/gif":  "png",
+}
+
+var imageContentTypes = map[string]string{
+	"jpeg": "image/jpeg",
+	"png":  "image/png",
+}
+
+var imageExtensions = map[string]string{
+	"jpeg": ".jpg",
+	"png":  ".png",
+}
+
+// Where uploaded images are stored, set up in setupImageStore
+var imageStore storage.Store
+
+// Images are kept on the local filesystem in HOAGIE_UPLOAD_DIR
+func setupImageStore() error {
+	dir := os.Getenv("HOAGIE_UPLOAD_DIR")
+	if dir == "" {
+		dir = "uploads"
+	}
+	store, err := storage.NewLocalStore(dir)
+	if err != nil {
+		return err
+	}
+	imageStore = store
+	go cleanupImages()
+	return nil
+}
+
+// How often images of expired and resolved posts are deleted
+const imageCleanupInterval = time.Hour
+
+// How long an uploaded image may go without being used by a post
+const orphanImageAge = 24 * time.Hour
+
+// Images are served by this API, so links in emails point back to it
+func imageURL(id string, thumbnail bool) string {
+	url := fmt.Sprintf("https://%s/stuff/images/%s/", os.Getenv("HOAGIE_HOST"), id)
+	if thumbnail {
+		url += "thumbnail/"
+	}
+	return url
+}
+
+// Get an uploaded image by its ID
+func getImage(id string) (ImageData, error) {
+	imageId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ImageData{}, fmt.Errorf("invalid image ID: %s", id)
+	}
+	var response ImageData
+	err = db.FindOne(client, "apps", "images", bson.D{{Key: "_id", Value: imageId}}, &response)
+	if err != nil {
+		return ImageData{}, fmt.Errorf("error getting image: %s", err)
+	}
+	return response, nil
+}
+
+// Ensures that the thumbnail of a post, if present, is an image uploaded
+// by the same user, writing an error response and returning false if not
+func validateThumbnail(w http.ResponseWriter, email string, thumbnail string) bool {
+	if thumbnail == "" {
+		return true
+	}
+	image, err := getImage(thumbnail)
+	if err != nil || image.Email != email {
+		response.Write(w, response.Invalid("thumbnail", "Thumbnail must be an image uploaded to Hoagie Stuff."))
+		return false
+	}
+	return true
+}
+
+// Get the bytes of the images a user has stored
+func storedImageBytes(email string) (int64, error) {
+	cursor, err := db.FindMany(client, "apps", "images", bson.D{{Key: "email", Value: email}},
+		options.Find().SetProjection(bson.D{{Key: "size", Value: 1}}))
+	if err != nil {
+		return 0, fmt.Errorf("error querying images: %s", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), REQUEST_TIMEOUT)
+	defer cancel()
+	defer cursor.Close(ctx)
+
+	var images []ImageData
+	if err := cursor.All(ctx, &images); err != nil {
+		return 0, fmt.Errorf("error decoding images: %s", err)
+	}
+	var total int64
+	for _, stored := range images {
+		total += stored.Size
+	}
+	return total, nil
+}
+
+// Deletes the image used as the thumbnail of a post, unless another post
+// that is still active uses it too. Thumbnails of older posts are Imgur
+// links, which are left alone.
+func releaseThumbnail(thumbnail string, postId primitive.ObjectID) error {
+	if thumbnail == "" || imageStore == nil {
+		return nil
+	}
+	imageData, err := getImage(thumbnail)
+	if err != nil {
+		return nil
+	}
+	count, err := db.CountDocuments(client, "apps", "stuff", append(bson.D{
+		{Key: "thumbnail", Value: thumbnail},
+		{Key: "_id", Value: bson.D{{Key: "$ne", Value: postId}}},
+	}, activeStuffFilter()...))
+	if err != nil || count > 0 {
+		return err
+	}
+	return deleteImage(imageData)
+}
+
+// Deletes an image along with its blobs
+func deleteImage(imageData ImageData) error {
+	if _, err := db.DeleteOne(client, "apps", "images", bson.D{{Key: "_id", Value: imageData.objectId()}}); err != nil {
+		return err
+	}
+	for _, key := range []string{imageData.Key, imageData.ThumbKey} {
+		if err := imageStore.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Every hour, delete the images of posts that expired or were resolved
+// and remove them from the posts, which are kept, then delete uploads
+// that were never used by a post
+func cleanupImages() {
+	for {
+		time.Sleep(imageCleanupInterval)
+		if err := deleteInactiveImages(); err != nil {
+			fmt.Printf("[!] Error deleting images of inactive posts: %s\n", err)
+		}
+		if err := deleteOrphanImages(time.Now().Add(-orphanImageAge)); err != nil {
+			fmt.Printf("[!] Error deleting unused images: %s\n", err)
+		}
+	}
+}
+
+// Filter for posts with a thumbnail that are resolved or expired
+func inactiveThumbnailFilter() bson.D {
+	return bson.D{
+		{Key: "thumbnail", Value: bson.D{{Key: "$nin", Value: bson.A{nil, ""}}}},
+		{Key: "$nor", Value: bson.A{activeStuffFilter()}},
+	}
+}
+
+func deleteInactiveImages() error {
+	cursor, err := db.FindMany(client, "apps", "stuff", inactiveThumbnailFilter(), options.Find())
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), REQUEST_TIMEOUT)
+	defer cancel()
+	defer cursor.Close(ctx)
+
+	var posts []PostData
+	if err := cursor.All(ctx, &posts); err != nil {
+		return err
+	}
+	for _, post := range posts {
+		if err := releaseThumbnail(post.Thumbnail, post.objectId()); err != nil {
+			return err
+		}
+		_, err := db.UpdateOne(client, "apps", "stuff",
+			bson.D{{Key: "_id", Value: post.objectId()}},
+			bson.D{{Key: "$set", Value: bson.D{{Key: "thumbnail", Value: ""}}}},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Deletes the images uploaded before a time that no post uses
+func deleteOrphanImages(before time.Time) error {
+	cursor, err := db.FindMany(client, "apps", "images",
+		bson.D{{Key: "createdAt", Value: bson.D{{Key: "$lt", Value: before}}}}, options.Find())
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), REQUEST_TIMEOUT)
+	defer cancel()
+	defer cursor.Close(ctx)
+
+	var images []ImageData
+	if err := cursor.All(ctx, &images); err != nil {
+		return err
+	}
+	for _, imageData := range images {
+		count, err := db.CountDocuments(client, "apps", "stuff", bson.D{{Key: "thumbnail", Value: imageData.Id}})
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		if err := deleteImage(imageData); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (imageData ImageData) objectId() primitive.ObjectID {
+	imageId, _ := primitive.ObjectIDFromHex(imageData.Id)
+	return imageId
+}
+
+// Decodes, validates and re-encodes an uploaded image, returning the
+// stored image and its thumbnail without any metadata
+func processImage(data []byte) (full []byte, thumb []byte, info ImageData, err error) {
+	format, ok := imageFormats[http.DetectContentType(data)]
+	if !ok {
+		return nil, nil, info, errors.New("Images must be JPEG, PNG or GIF files.")
+	}
+
+	// Check the dimensions before decoding so huge images are not loaded
+	// into memory. Each side is bounded first so the product cannot overflow.
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, info, errors.New("Image could not be read.")
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, nil, info, errors.New("Image could not be read.")
+	}
+	if config.Width > maxImagePixels || config.Height > maxImagePixels/config.Width {
+		return nil, nil, info, errors.New("Image dimensions are too large.")
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, info, errors.New("Image could not be read.")
+	}
+
+	img := toRGBA(decoded)
+	if format == "jpeg" {
+		img = applyOrientation(img, jpegOrientation(data))
+	}
+	img = resizeImage(img, imageMaxSide)
+	if full, err = encodeImage(img, format); err != nil {
+		return nil, nil, info, err
+	}
+	if thumb, err = encodeImage(resizeImage(img, thumbnailMaxSide), format); err != nil {
+		return nil, nil, info, err
+	}
+
+	info.ContentType = imageContentTypes[format]
+	info.Width = img.Rect.Dx()
+	info.Height = img.Rect.Dy()
+	return full, thumb, info, nil
+}
+
+// POST /stuff/images
+var imageUploadHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	user, success := getUser(r.Header.Get("authorization"))
+	if !success {
+		response.Write(w, response.Unauthorized("You do not have access to upload images."))
+		return
+	}
+	if imageStore == nil {
+		response.Write(w, response.Unavailable("Image uploads are not available right now."))
+		return
+	}
+	if os.Getenv("HOAGIE_MODE") != "debug" && !getUploadLimiter(user.Email).Allow() {
+		response.Write(w, response.TooManyRequests("You have uploaded too many images recently. Please try again later."))
+		return
+	}
+
+	// Leave some room for the rest of the multipart body
+	r.Body = http.MaxBytesReader(w, r.Body, maxImageBytes+1<<20)
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		response.Write(w, response.Invalid("image", "Request did not contain an image under 5 MB."))
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxImageBytes+1))
+	if err != nil {
+		response.Write(w, response.BadRequest("Image could not be read."))
+		return
+	}
+	if len(data) > maxImageBytes {
+		response.Write(w, response.Invalid("image", "Please keep your image under 5 MB."))
+		return
+	}
+
+	full, thumb, imageData, err := processImage(data)
+	if err != nil {
+		response.Write(w, response.Invalid("image", err.Error()))
+		return
+	}
+
+	used, err := storedImageBytes(user.Email)
+	if err != nil {
+		response.Write(w, response.Internal(err))
+		return
+	}
+	size := int64(len(full) + len(thumb))
+	if used+size > maxUserImageBytes {
+		response.Write(w, response.QuotaExceeded(fmt.Sprintf("You can only store %d MB of images. Try deleting a post with an image and upload again.", maxUserImageBytes>>20)))
+		return
+	}
+
+	imageId := primitive.NewObjectID()
+	extension := imageExtensions[imageFormats[http.DetectContentType(data)]]
+	imageData.Email = user.Email
+	imageData.Key = imageId.Hex() + extension
+	imageData.ThumbKey = imageId.Hex() + "_thumb" + extension
+	imageData.Size = size
+	imageData.CreatedAt = time.Now()
+
+	if err := imageStore.Put(imageData.Key, full); err != nil {
+		response.Write(w, response.Internal(err))
+		return
+	}
+	if err := imageStore.Put(imageData.ThumbKey, thumb); err != nil {
+		imageStore.Delete(imageData.Key)
+		response.Write(w, response.Internal(err))
+		return
+	}
+	_, err = db.InsertOne(client, "apps", "images", bson.D{
+		{Key: "_id", Value: imageId},
+		{Key: "email", Value: imageData.Email},
+		{Key: "key", Value: imageData.Key},
+		{Key: "thumbKey", Value: imageData.ThumbKey},
+		{Key: "contentType", Value: imageData.ContentType},
+		{Key: "width", Value: imageData.Width},
+		{Key: "height", Value: imageData.Height},
+		{Key: "size", Value: imageData.Size},
+		{Key: "createdAt", Value: imageData.CreatedAt},
+	})
+	if err != nil {
+		imageStore.Delete(imageData.Key)
+		imageStore.Delete(imageData.ThumbKey)
+		response.Write(w, response.Internal(err))
+		return
+	}
+
+	response.JSON(w, http.StatusOK, ImageResponse{
+		Id:           imageId.Hex(),
+		URL:          imageURL(imageId.Hex(), false),
+		ThumbnailURL: imageURL(imageId.Hex(), true),
+	})
+})
+
+// GET /stuff/images/{id} and /stuff/images/{id}/thumbnail
+func imageServeHandler(thumbnail bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if imageStore == nil {
+			response.Write(w, response.Unavailable("Images are not available right now."))
+			return
+		}
+		imageData, err := getImage(mux.Vars(r)["id"])
+		if err != nil {
+			response.Write(w, response.NotFound("Image not found."))
+			return
+		}
+		key := imageData.Key
+		if thumbnail {
+			key = imageData.ThumbKey
+		}
+		data, contentType, err := imageStore.Get(key)
+		if err != nil {
+			response.Write(w, response.NotFound("Image not found."))
+			return
+		}
+		// Images never change once uploaded
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		w.Write(data)
+	})
+}
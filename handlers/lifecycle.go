@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"fmt"
+	"hoagie-profile/config"
+	"hoagie-profile/db"
+	"hoagie-profile/response"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// States of a Stuff post. Posts are never removed when they expire or are
+// resolved, they are only hidden from the feed and the digest.
+const (
+	stateActive   = "active"
+	stateResolved = "resolved"
+	stateExpired  = "expired"
+)
+
+// Filter conditions for posts that are neither resolved nor expired
+func activeStuffFilter() bson.D {
+	return bson.D{
+		{Key: "state", Value: bson.D{{Key: "$ne", Value: stateResolved}}},
+		config.UnexpiredFilter(time.Now()),
+	}
+}
+
+// Filter conditions for posts shown in the feed, which are active and
+// have not been hidden by moderators or reports
+func visibleStuffFilter() bson.D {
+	return append(activeStuffFilter(), bson.E{Key: "hidden", Value: bson.D{{Key: "$ne", Value: true}}})
+}
+
+// Returns the state of a post, taking its expiration into account
+func (post PostData) currentState() string {
+	if post.State == stateResolved {
+		return stateResolved
+	}
+	expiresAt := post.ExpiresAt
+	if expiresAt.IsZero() {
+		expiresAt = post.CreatedAt.Add(time.Duration(EXPIRATION_DURATION) * time.Second)
+	}
+	if time.Now().After(expiresAt) {
+		return stateExpired
+	}
+	return stateActive
+}
+
+// Returns the expiration chosen for a post created at the given time,
+// or the category default if none was chosen. Writes an error response
+// and returns false if the expiration is outside of the category bounds.
+func postExpiration(w http.ResponseWriter, postReq PostData, createdAt time.Time, stuffConfig config.Stuff, taxonomy config.Taxonomy) (time.Time, bool) {
+	bounds := stuffConfig.ExpirationFor(taxonomy.Group(postReq.Category))
+	if postReq.ExpiresAt.IsZero() {
+		return createdAt.AddDate(0, 0, bounds.DefaultDays), true
+	}
+
+	earliest := createdAt.AddDate(0, 0, bounds.MinDays)
+	latest := createdAt.AddDate(0, 0, bounds.MaxDays)
+	if postReq.ExpiresAt.Before(earliest) || postReq.ExpiresAt.After(latest) {
+		responseString := fmt.Sprintf("Posts in this category need to stay up between %d and %d days.", bounds.MinDays, bounds.MaxDays)
+		response.Write(w, response.Invalid("expiresAt", responseString))
+		return time.Time{}, false
+	}
+	return postReq.ExpiresAt, true
+}
+
+// An edit that does not set an expiration keeps the one the post has,
+// unless the post moves to a group with other bounds and gets its default
+func editedExpiration(postReq PostData, current PostData, taxonomy config.Taxonomy) time.Time {
+	if !postReq.ExpiresAt.IsZero() || taxonomy.Group(postReq.Category) != taxonomy.Group(current.Category) {
+		return postReq.ExpiresAt
+	}
+	return current.ExpiresAt
+}
+
+// POST /stuff/user/{id}/resolve
+var stuffResolveHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	user, success := getUser(r.Header.Get("authorization"))
+	if !success {
+		response.Write(w, response.Unauthorized("You do not have access to resolve this post."))
+		return
+	}
+
+	current, err := getUserPost(user.Email, mux.Vars(r)["id"])
+	if err != nil {
+		response.Write(w, response.NotFound("Could not find the specified post. Try refreshing the page."))
+		return
+	}
+	if current.State == stateResolved {
+		response.Write(w, response.Conflict("This post has already been marked as resolved."))
+		return
+	}
+
+	_, err = db.UpdateOne(client, "apps", "stuff",
+		bson.D{
+			{Key: "_id", Value: current.objectId()},
+			{Key: "email", Value: user.Email},
+		},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "state", Value: stateResolved},
+			{Key: "resolvedAt", Value: time.Now()},
+		}}},
+	)
+	if err != nil {
+		response.Write(w, response.Internal(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte("{\"Status\": \"OK\"}"))
+})
@@ -18,6 +18,16 @@ var mailLimit = rate.Every(mailLimitNumber)
 const testMailLimitNumber = 1 * time.Minute
 var testMailLimit = rate.Every(testMailLimitNumber)
 
+// Contact relay limit is 5 messages, refilled at 1 per 12 minutes
+const contactLimitNumber = 12 * time.Minute
+const contactLimitBurst = 5
+var contactLimit = rate.Every(contactLimitNumber)
+
+// Image upload limit is 10 images, refilled at 1 per 6 minutes
+const uploadLimitNumber = 6 * time.Minute
+const uploadLimitBurst = 10
+var uploadLimit = rate.Every(uploadLimitNumber)
+
 // Holds rate limiters for normal emails and test emails
 type visitor struct {
 	emailLimiter     *rate.Limiter
@@ -25,8 +35,18 @@ type visitor struct {
 	lastSeen    time.Time
 }
 
+// Holds a single rate limiter, such as for contact messages. These are
+// kept apart from the visitors, which are deleted when a request fails
+// validation, so that they cannot be reset by posting invalid requests.
+type limitedVisitor struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
 // Map email handle to visitor pointers
 var visitors = make(map[string]*visitor)
+var contactVisitors = make(map[string]*limitedVisitor)
+var uploadVisitors = make(map[string]*limitedVisitor)
 var mu sync.Mutex
 
 // Run a background goroutine to remove old entries from the visitors map
@@ -55,6 +75,29 @@ func getVisitor(email string) *visitor {
 	return v
 }
 
+// getLimiter returns the limiter of a visitor queried by their email
+// handle, creating it with the given limit if it does not already exist
+func getLimiter(limited map[string]*limitedVisitor, email string, limit rate.Limit, burst int) *rate.Limiter {
+	mu.Lock()
+	defer mu.Unlock()
+
+	v, exists := limited[email]
+	if !exists {
+		v = &limitedVisitor{rate.NewLimiter(limit, burst), time.Now()}
+		limited[email] = v
+	}
+	v.lastSeen = time.Now()
+	return v.limiter
+}
+
+func getContactLimiter(email string) *rate.Limiter {
+	return getLimiter(contactVisitors, email, contactLimit, contactLimitBurst)
+}
+
+func getUploadLimiter(email string) *rate.Limiter {
+	return getLimiter(uploadVisitors, email, uploadLimit, uploadLimitBurst)
+}
+
 // Deletes visitor limit, noop if not existent
 func deleteVisitor(email string) {
 	mu.Lock()
@@ -75,6 +118,14 @@ func cleanupVisitors() {
 				delete(visitors, email)
 			}
 		}
+		// Contact and upload limiters are full again well before then
+		for _, limited := range []map[string]*limitedVisitor{contactVisitors, uploadVisitors} {
+			for email, v := range limited {
+				if time.Since(v.lastSeen) > mailLimitNumber {
+					delete(limited, email)
+				}
+			}
+		}
 		mu.Unlock()
 	}
 }
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"hoagie-profile/config"
+	"hoagie-profile/response"
+	"net/http"
+	"time"
+)
+
+// Details of a lost & found post
+type LostFoundInfo struct {
+	// Either "lost" or "found"
+	Kind string `json:"kind" bson:"kind"`
+	// When the item was lost or found
+	Date time.Time `json:"date" bson:"date"`
+	// Key of one of config.CampusLocations
+	Location string `json:"location" bson:"location"`
+	// Key of one of config.ItemTypes
+	ItemType string `json:"itemType" bson:"itemType"`
+	// Opts the poster out of match suggestions from cmd/match
+	NoMatches bool `json:"noMatches" bson:"noMatches"`
+}
+
+// How far back a lost or found date can be
+const lostFoundMaxAge = 90 * 24 * time.Hour
+
+// Validates the details of a lost & found post, which are required for
+// the lost & found group, writing an error response and returning false if
+// any of them are invalid. The tags of the post are set to its kind,
+// which is how lost and found posts were told apart before.
+func validateLostFound(w http.ResponseWriter, postReq *PostData, taxonomy config.Taxonomy) bool {
+	info := postReq.LostFound
+	if taxonomy.Group(postReq.Category) != "lost" {
+		if info != nil {
+			response.Write(w, response.Invalid("lostFound", "Only lost & found posts can include lost & found details."))
+			return false
+		}
+		return true
+	}
+	if info == nil {
+		response.Write(w, response.Invalid("lostFound", "Lost & found posts need to include whether the item was lost or found, when, where and what it is."))
+		return false
+	}
+	if info.Kind != "lost" && info.Kind != "found" {
+		response.Write(w, response.Invalid("lostFound.kind", "Lost & found posts need to be either lost or found."))
+		return false
+	}
+	// Allow a day of leeway for time zones
+	now := time.Now()
+	if info.Date.IsZero() || info.Date.After(now.Add(24*time.Hour)) || info.Date.Before(now.Add(-lostFoundMaxAge)) {
+		response.Write(w, response.Invalid("lostFound.date", "Date needs to be within the last 90 days."))
+		return false
+	}
+	if _, ok := config.CampusLocations[info.Location]; !ok {
+		response.Write(w, response.Invalid("lostFound.location", "Invalid location of the item."))
+		return false
+	}
+	if _, ok := config.ItemTypes[info.ItemType]; !ok {
+		response.Write(w, response.Invalid("lostFound.itemType", "Invalid type of the item."))
+		return false
+	}
+	postReq.Tags = []string{info.Kind}
+	return true
+}
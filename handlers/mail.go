@@ -2,9 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"hoagie-profile/auth"
 	"hoagie-profile/db"
+	"hoagie-profile/mail"
+	"hoagie-profile/response"
 	"net/http"
 	"os"
 	"time"
@@ -12,6 +15,7 @@ import (
 	mailjet "github.com/mailjet/mailjet-apiv3-go"
 	bluemonday "github.com/microcosm-cc/bluemonday"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // BlueMonday sanitizes HTML, preventing unsafe user input
@@ -112,24 +116,17 @@ func sendEmail(req MailRequest) error {
 		messagesInfo = createInfoMessage(req, req.Email)
 	}
 
-	messages := mailjet.MessagesV31{Info: messagesInfo}
-
 	if os.Getenv("HOAGIE_MODE") == "debug" {
-		printDebug(messages)
+		printDebug(mailjet.MessagesV31{Info: messagesInfo})
 		return nil
 	}
-
-	mailjetClient := mailjet.NewMailjetClient(os.Getenv("MAILJET_PUBLIC_KEY"), os.Getenv("MAILJET_PRIVATE_KEY"))
-	res, err := mailjetClient.SendMailV31(&messages)
-
-	if err != nil {
-		return err
-	}
-	if len(res.ResultsV31) > 0 && res.ResultsV31[0].Status == "success" {
+	_, err := mail.SendTracked(client, primitive.NewObjectID(), req.Email, messagesInfo[0])
+	// The email went out, only its delivery stats are missing
+	if errors.Is(err, mail.ErrNotRecorded) {
+		fmt.Println("Error recording sent mail:", err)
 		return nil
 	}
-
-	return fmt.Errorf("mail service received an error, possibly because of limits")
+	return err
 }
 
 func printDebug(messages mailjet.MessagesV31) {
@@ -153,48 +150,45 @@ func printDebug(messages mailjet.MessagesV31) {
 func handleScheduledEmail(w http.ResponseWriter, mailReq MailRequest, user auth.User) bool {
 	// Validate that schedule is valid
 	if !scheduleValid(mailReq.Schedule) {
-		http.Error(
-			w,
-			"Your email could not be scheduled at the specified time. Please refresh the page and select a later time.",
-			http.StatusBadRequest,
-		)
+		response.Write(w, response.Invalid("schedule",
+			"Your email could not be scheduled at the specified time. Please refresh the page and select a later time."))
 		return false
 	}
 
 	// Convert time to EST and check for errors
 	est, err := time.LoadLocation("America/New_York")
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Hoagie Mail service had an error: %s.", err.Error()), http.StatusNotFound)
+		response.Write(w, response.Internal(err))
 		return false
 	}
 	scheduleEST, err := time.ParseInLocation(time.RFC3339, mailReq.Schedule, est)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Hoagie Mail service had an error: %s.", err.Error()), http.StatusNotFound)
+		response.Write(w, response.Invalid("schedule", "Invalid schedule of the email."))
 		return false
 	}
 
 	// Check that user doesn't have an already-existing entry
 	currentScheduledMail, err := getScheduled(user, scheduleEST)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Hoagie Mail service had an error: %s.", err.Error()), http.StatusNotFound)
+		response.Write(w, response.Internal(err))
 		return false
 	}
 	if currentScheduledMail != (ScheduledMail{}) {
 		errString := "You already have an email scheduled for this time. If you would like to change"
 		errString += " your message, please delete your mail in the Scheduled Emails page and try again."
-		http.Error(w, errString, http.StatusBadRequest)
+		response.Write(w, response.Conflict(errString))
 		return false
 	}
 
 	// Add to MongoDB
 	db.InsertOne(client, "apps", "mail", bson.D{
-		{Key: "Email", Value: mailReq.Email},
-		{Key: "Sender", Value: mailReq.Sender},
-		{Key: "Header", Value: mailReq.Header},
-		{Key: "Body", Value: mailReq.Body},
-		{Key: "Schedule", Value: scheduleEST},
-		{Key: "UserName", Value: user.Name},
-		{Key: "CreatedAt", Value: time.Now()},
+		{Key: "email", Value: mailReq.Email},
+		{Key: "sender", Value: mailReq.Sender},
+		{Key: "header", Value: mailReq.Header},
+		{Key: "body", Value: mailReq.Body},
+		{Key: "schedule", Value: scheduleEST},
+		{Key: "userName", Value: user.Name},
+		{Key: "createdAt", Value: time.Now()},
 	})
 	return true
 }
@@ -207,17 +201,15 @@ func handleEmailNow(w http.ResponseWriter, mailReq MailRequest, user auth.User)
 
 		if mailReq.Schedule == "test" {
 			if !visitor.testEmailLimiter.Allow() {
-				http.Error(w, "You have reached your send limit. "+
-					"You can only send one test email every 1 minute.",
-					http.StatusTooManyRequests)
+				response.Write(w, response.TooManyRequests("You have reached your send limit. "+
+					"You can only send one test email every 1 minute."))
 				return false
 			}
 		} else if !visitor.emailLimiter.Allow() {
-			http.Error(w, "You have reached your send limit. "+
+			response.Write(w, response.TooManyRequests("You have reached your send limit. "+
 				"You can only send one email every 6 hours. "+
 				"If you need to send an email urgently, "+
-				"please contact hoagie@princeton.edu",
-				http.StatusTooManyRequests)
+				"please contact hoagie@princeton.edu"))
 			return false
 		}
 	}
@@ -231,7 +223,7 @@ func handleEmailNow(w http.ResponseWriter, mailReq MailRequest, user auth.User)
 	err := sendEmail(mailReq)
 
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Hoagie Mail service had an error: %s.", err.Error()), http.StatusNotFound)
+		response.Write(w, response.Internal(err))
 		deleteVisitor(user.Email)
 		return false
 	}
@@ -247,25 +239,25 @@ func handleEmailNow(w http.ResponseWriter, mailReq MailRequest, user auth.User)
 var sendHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 	user, success := getUser(r.Header.Get("authorization"))
 	if !success {
-		http.Error(w, "You do not have access to send mail.", http.StatusBadRequest)
+		response.Write(w, response.Unauthorized("You do not have access to send mail."))
 		return
 	}
 
 	if len(user.Name) == 0 {
-		http.Error(w, `Hoagie Mail has been updated. Please log-out and log-in again.`, http.StatusBadRequest)
+		response.Write(w, response.Unauthorized(`Hoagie Mail has been updated. Please log-out and log-in again.`))
 		return
 	}
 
 	var mailReq MailRequest
 	err := json.NewDecoder(r.Body).Decode(&mailReq)
 	if err != nil {
-		http.Error(w, "Message did not contain correct fields.", http.StatusBadRequest)
+		response.Write(w, response.BadRequest("Message did not contain correct fields."))
 		return
 	}
-	if notBetween(w, mailReq.Sender, "sender name", 3, 30) {
+	if notBetween(w, "sender", mailReq.Sender, "sender name", 3, 30) {
 		return
 	}
-	if notBetween(w, mailReq.Header, "email subject", 3, 150) {
+	if notBetween(w, "header", mailReq.Header, "email subject", 3, 150) {
 		return
 	}
 
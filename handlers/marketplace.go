@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"fmt"
+	"hoagie-profile/config"
+	"hoagie-profile/response"
+	"math"
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+)
+
+// Item details of a marketplace post
+type MarketplaceInfo struct {
+	// Price in cents, 0 for free items
+	Price      int64  `json:"price" bson:"price"`
+	Negotiable bool   `json:"negotiable" bson:"negotiable"`
+	Condition  string `json:"condition" bson:"condition"`
+	Quantity   int    `json:"quantity" bson:"quantity"`
+	// Where the buyer can pick up the item
+	Pickup string `json:"pickup" bson:"pickup"`
+}
+
+// All valid item conditions
+var conditionTypes = map[string]bool{
+	"new":      true,
+	"like-new": true,
+	"good":     true,
+	"fair":     true,
+	"poor":     true,
+}
+
+// Limits for marketplace items
+const (
+	maxPriceCents  = 100_000_00
+	maxQuantity    = 100
+	maxPickupChars = 100
+)
+
+// Validates the item details of a marketplace post, which are required
+// for the marketplace group, writing an error response and returning
+// false if any of them are invalid. A missing quantity defaults to a
+// single item.
+func validateMarketplace(w http.ResponseWriter, postReq *PostData, taxonomy config.Taxonomy) bool {
+	info := postReq.Marketplace
+	if taxonomy.Group(postReq.Category) != "marketplace" {
+		if info != nil {
+			response.Write(w, response.Invalid("marketplace", "Only marketplace posts can include item details."))
+			return false
+		}
+		return true
+	}
+	if info == nil {
+		response.Write(w, response.Invalid("marketplace", "Marketplace posts need to include the price and condition of the item."))
+		return false
+	}
+	if info.Price < 0 || info.Price > maxPriceCents {
+		response.Write(w, response.Invalid("marketplace.price", fmt.Sprintf("Price needs to be between $0 and $%d.", maxPriceCents/100)))
+		return false
+	}
+	if !conditionTypes[info.Condition] {
+		response.Write(w, response.Invalid("marketplace.condition", "Invalid condition of the item."))
+		return false
+	}
+	if info.Quantity == 0 {
+		info.Quantity = 1
+	}
+	if info.Quantity < 1 || info.Quantity > maxQuantity {
+		response.Write(w, response.Invalid("marketplace.quantity", fmt.Sprintf("Quantity needs to be between 1 and %d.", maxQuantity)))
+		return false
+	}
+	if utf8.RuneCountInString(info.Pickup) > maxPickupChars {
+		response.Write(w, response.Invalid("marketplace.pickup", fmt.Sprintf("Please keep your pickup location under the %d-character limit.", maxPickupChars)))
+		return false
+	}
+	return true
+}
+
+// Parses a price query parameter given in dollars, such as 25 or 12.50,
+// into cents. Prices above the highest allowed price are capped at it.
+func parsePrice(value string) (int64, error) {
+	dollars, err := strconv.ParseFloat(value, 64)
+	if err != nil || dollars < 0 || math.IsInf(dollars, 0) || math.IsNaN(dollars) {
+		return 0, fmt.Errorf("invalid price: %s", value)
+	}
+	return int64(math.Min(math.Round(dollars*100), maxPriceCents)), nil
+}
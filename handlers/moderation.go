@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hoagie-profile/config"
+	"hoagie-profile/db"
+	"hoagie-profile/response"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Report of a post by a user, at most one per user and post
+type Report struct {
+	Id        string    `json:"id" bson:"_id,omitempty"`
+	PostId    string    `json:"postId" bson:"postId"`
+	Email     string    `json:"email" bson:"email"`
+	Reason    string    `json:"reason" bson:"reason"`
+	Details   string    `json:"details" bson:"details"`
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+}
+
+// Reported post in the moderator queue
+type ModerationItem struct {
+	Post        PostData `json:"post"`
+	ReportCount int      `json:"reportCount"`
+	Reports     []Report `json:"reports"`
+}
+
+// All valid reasons for reporting a post
+var reportReasons = map[string]bool{
+	"scam":          true,
+	"inappropriate": true,
+	"spam":          true,
+	"other":         true,
+}
+
+const maxReportDetailsChars = 500
+
+// Posts that were reported or hidden and have not been reviewed by a moderator
+func moderationFilter() bson.D {
+	return bson.D{
+		{Key: "reviewed", Value: bson.D{{Key: "$ne", Value: true}}},
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "reportCount", Value: bson.D{{Key: "$gt", Value: 0}}}},
+			bson.D{{Key: "hidden", Value: true}},
+		}},
+	}
+}
+
+// Get the reports of a post, oldest first
+func getReports(postId primitive.ObjectID) ([]Report, error) {
+	reports := []Report{}
+
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{Key: "createdAt", Value: 1}})
+
+	resultCursor, err := db.FindMany(client, "apps", "reports", bson.D{{Key: "postId", Value: postId}}, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("error getting reports: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), REQUEST_TIMEOUT)
+	defer cancel()
+	defer resultCursor.Close(ctx)
+
+	if err := resultCursor.All(ctx, &reports); err != nil {
+		return nil, fmt.Errorf("error decoding reports: %s", err)
+	}
+	return reports, nil
+}
+
+// Get the moderator queue, most reported posts first
+func getModerationQueue() ([]ModerationItem, error) {
+	queue := []ModerationItem{}
+
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{Key: "reportCount", Value: -1}, {Key: "createdAt", Value: -1}})
+
+	resultCursor, err := db.FindMany(client, "apps", "stuff", moderationFilter(), findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("error getting reported posts: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), REQUEST_TIMEOUT)
+	defer cancel()
+	defer resultCursor.Close(ctx)
+
+	var posts []PostData
+	if err := resultCursor.All(ctx, &posts); err != nil {
+		return nil, fmt.Errorf("error decoding reported posts: %s", err)
+	}
+	for _, post := range posts {
+		reports, err := getReports(post.objectId())
+		if err != nil {
+			return nil, err
+		}
+		post.State = post.currentState()
+		queue = append(queue, ModerationItem{Post: post, ReportCount: post.ReportCount, Reports: reports})
+	}
+	return queue, nil
+}
+
+// Sets whether a post is hidden and marks it as reviewed, so that it
+// leaves the queue. The reports it had so far are recorded as reviewed,
+// so that only newer reports count towards hiding it again.
+func moderatePost(w http.ResponseWriter, r *http.Request, hidden bool) {
+	admin, success := getAdmin(w, r.Header.Get("authorization"), "You do not have access to moderate posts.")
+	if !success {
+		return
+	}
+
+	post, err := getPost(mux.Vars(r)["id"])
+	if err != nil {
+		response.Write(w, response.NotFound("Could not find the specified post."))
+		return
+	}
+	_, err = db.UpdateOne(client, "apps", "stuff",
+		bson.D{{Key: "_id", Value: post.objectId()}},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "hidden", Value: hidden},
+			{Key: "reviewed", Value: true},
+			{Key: "reviewedReportCount", Value: post.ReportCount},
+			{Key: "moderatedBy", Value: admin.Email},
+			{Key: "moderatedAt", Value: time.Now()},
+		}}},
+	)
+	if err != nil {
+		response.Write(w, response.Internal(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte("{\"Status\": \"OK\"}"))
+}
+
+// POST /stuff/{id}/report
+var stuffReportHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	user, success := getUser(r.Header.Get("authorization"))
+	if !success {
+		response.Write(w, response.Unauthorized("You do not have access to report posts."))
+		return
+	}
+
+	var reportReq Report
+	if err := json.NewDecoder(r.Body).Decode(&reportReq); err != nil {
+		response.Write(w, response.BadRequest("Report did not contain correct fields."))
+		return
+	}
+	if !reportReasons[reportReq.Reason] {
+		response.Write(w, response.Invalid("reason", "Invalid reason for the report."))
+		return
+	}
+	reportReq.Details = strings.TrimSpace(reportReq.Details)
+	if utf8.RuneCountInString(reportReq.Details) > maxReportDetailsChars {
+		response.Write(w, response.Invalid("details", fmt.Sprintf("Please keep your details under the %d-character limit.", maxReportDetailsChars)))
+		return
+	}
+
+	post, err := getPost(mux.Vars(r)["id"])
+	if err != nil {
+		response.Write(w, response.NotFound("Could not find the specified post. Try refreshing the page."))
+		return
+	}
+	if post.Email == user.Email {
+		response.Write(w, response.Forbidden("You cannot report your own post."))
+		return
+	}
+
+	_, err = db.InsertOne(client, "apps", "reports", bson.D{
+		{Key: "postId", Value: post.objectId()},
+		{Key: "email", Value: user.Email},
+		{Key: "reason", Value: reportReq.Reason},
+		{Key: "details", Value: reportReq.Details},
+		{Key: "createdAt", Value: time.Now()},
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		response.Write(w, response.Conflict("You have already reported this post."))
+		return
+	}
+	if err != nil {
+		response.Write(w, response.Internal(err))
+		return
+	}
+
+	stuffConfig, err := config.LoadStuff(client)
+	if err != nil {
+		response.Write(w, response.Internal(err))
+		return
+	}
+	// A new report puts reviewed posts back in the moderation queue
+	_, err = db.UpdateOne(client, "apps", "stuff",
+		bson.D{{Key: "_id", Value: post.objectId()}},
+		bson.D{
+			{Key: "$inc", Value: bson.D{{Key: "reportCount", Value: 1}}},
+			{Key: "$set", Value: bson.D{{Key: "reviewed", Value: false}}},
+		},
+	)
+	if err != nil {
+		response.Write(w, response.Internal(err))
+		return
+	}
+	// Reports a moderator already reviewed do not count towards hiding the post
+	_, err = db.UpdateOne(client, "apps", "stuff",
+		bson.D{
+			{Key: "_id", Value: post.objectId()},
+			{Key: "$expr", Value: bson.D{{Key: "$gte", Value: bson.A{
+				bson.D{{Key: "$subtract", Value: bson.A{
+					"$reportCount",
+					bson.D{{Key: "$ifNull", Value: bson.A{"$reviewedReportCount", 0}}},
+				}}},
+				stuffConfig.ReportThreshold,
+			}}}},
+		},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "hidden", Value: true},
+			{Key: "moderatedBy", Value: "reports"},
+			{Key: "moderatedAt", Value: time.Now()},
+		}}},
+	)
+	if err != nil {
+		response.Write(w, response.Internal(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte("{\"Status\": \"OK\"}"))
+})
+
+// GET /admin/stuff/reports
+var moderationQueueHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	if _, success := getAdmin(w, r.Header.Get("authorization"), "You do not have access to moderate posts."); !success {
+		return
+	}
+
+	queue, err := getModerationQueue()
+	if err != nil {
+		response.Write(w, response.Internal(err))
+		return
+	}
+	response.JSON(w, http.StatusOK, queue)
+})
+
+// POST /admin/stuff/{id}/hide
+var moderationHideHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	moderatePost(w, r, true)
+})
+
+// POST /admin/stuff/{id}/restore
+var moderationRestoreHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	moderatePost(w, r, false)
+})
+
+// DELETE /admin/stuff/{id}
+var moderationDeleteHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	admin, success := getAdmin(w, r.Header.Get("authorization"), "You do not have access to moderate posts.")
+	if !success {
+		return
+	}
+
+	post, err := getPost(mux.Vars(r)["id"])
+	if err != nil {
+		response.Write(w, response.NotFound("Could not find the specified post."))
+		return
+	}
+	_, err = db.DeleteOne(client, "apps", "stuff", bson.D{{Key: "_id", Value: post.objectId()}})
+	if err != nil {
+		response.Write(w, response.Internal(err))
+		return
+	}
+	if err := releaseThumbnail(post.Thumbnail, post.objectId()); err != nil {
+		fmt.Println("Error deleting image of deleted post:", err)
+	}
+	// Reports are kept for the record
+	db.UpdateMany(client, "apps", "reports",
+		bson.D{{Key: "postId", Value: post.objectId()}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "deletedBy", Value: admin.Email}}}},
+		options.Update(),
+	)
+	fmt.Printf("STUFF: %s deleted the post '%s' by %s.\n", admin.Email, post.Title, post.Email)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte("{\"Status\": \"OK\"}"))
+})
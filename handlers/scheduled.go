@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"hoagie-profile/auth"
 	"hoagie-profile/db"
+	"hoagie-profile/response"
 	"net/http"
 	"time"
 
@@ -19,13 +20,13 @@ type UserScheduledMail struct {
 }
 
 type ScheduledMail struct {
-	Header    string    `json:"header"`
-	Sender    string    `json:"sender"`
-	Body      string    `json:"body"`
-	Email     string    `json:"email"`
-	UserName  string    `json:"userName"`
-	Schedule  time.Time `json:"schedule"`
-	CreatedAt time.Time `json:"createdAt"`
+	Header    string    `json:"header" bson:"header"`
+	Sender    string    `json:"sender" bson:"sender"`
+	Body      string    `json:"body" bson:"body"`
+	Email     string    `json:"email" bson:"email"`
+	UserName  string    `json:"userName" bson:"userName"`
+	Schedule  time.Time `json:"schedule" bson:"schedule"`
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
 }
 
 type ScheduleRequest struct {
@@ -38,8 +39,8 @@ type ScheduleRequest struct {
 func getScheduled(user auth.User, scheduledTime time.Time) (ScheduledMail, error) {
 	var response ScheduledMail
 	err := db.FindOne(client, "apps", "mail", bson.D{
-		{Key: "Email", Value: user.Email},
-		{Key: "Schedule", Value: scheduledTime},
+		{Key: "email", Value: user.Email},
+		{Key: "schedule", Value: scheduledTime},
 	}, &response)
 	if err != nil { // Check that error means no docs found?
 		return ScheduledMail{}, nil
@@ -54,10 +55,10 @@ func getAllScheduled(user auth.User) (UserScheduledMail, error) {
 	// Get responses in chronological order
 	findOptions := options.Find()
 	findOptions.SetSort(bson.D{
-		{Key: "Schedule", Value: 1},
+		{Key: "schedule", Value: 1},
 	})
 	query := bson.D{
-		{Key: "Email", Value: user.Email},
+		{Key: "email", Value: user.Email},
 	}
 
 	// Perform database search
@@ -102,86 +103,84 @@ func getAllScheduled(user auth.User) (UserScheduledMail, error) {
 var scheduledSendHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 	user, success := getUser(r.Header.Get("authorization"))
 	if !success {
-		http.Error(w, "You do not have access to schedule mail.", http.StatusBadRequest)
+		response.Write(w, response.Unauthorized("You do not have access to schedule mail."))
 		return
 	}
 	if len(user.Name) == 0 {
-		http.Error(w, `Hoagie has been updated. Please log-out and log-in again.`, http.StatusBadRequest)
+		response.Write(w, response.Unauthorized(`Hoagie has been updated. Please log-out and log-in again.`))
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	var scheduleReq ScheduleRequest
 	err := json.NewDecoder(r.Body).Decode(&scheduleReq)
 	if err != nil {
-		http.Error(w, "Request body doesn't contain correct fields", http.StatusBadRequest)
+		response.Write(w, response.BadRequest("Request body doesn't contain correct fields"))
 		return
 	}
 
 	// Convert time to EST and check for errors
 	est, err := time.LoadLocation("America/New_York")
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Hoagie Mail service had an error: %s", err.Error()), http.StatusNotFound)
+		response.Write(w, response.Internal(err))
 		return
 	}
 	scheduleEST, err := time.ParseInLocation(time.RFC3339, scheduleReq.Schedule, est)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Hoagie Mail service had an error: %s", err.Error()), http.StatusNotFound)
+		response.Write(w, response.Invalid("schedule", "Invalid schedule of the email."))
 		return
 	}
 
 	// Check that the specified scheduled send exists
 	currentScheduledMail, err := getScheduled(user, scheduleEST)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Hoagie Mail service had an error: %s", err.Error()), http.StatusNotFound)
+		response.Write(w, response.Internal(err))
 		return
 	}
 	if currentScheduledMail == (ScheduledMail{}) {
-		http.Error(w, "Could not find the specified email. Try refreshing the page.", http.StatusBadRequest)
+		response.Write(w, response.NotFound("Could not find the specified email. Try refreshing the page."))
 		return
 	}
 
 	// Validate and confirm the new scheduled time
 	if !scheduleValid(scheduleReq.NewSchedule) {
-		http.Error(
-			w,
-			"Your email could not be scheduled at the specified time. Please refresh the page and select a later time.",
-			http.StatusBadRequest,
-		)
+		response.Write(w, response.Invalid("newSchedule",
+			"Your email could not be scheduled at the specified time. Please refresh the page and select a later time."))
 		return
 	}
 	newScheduleEST, err := time.ParseInLocation(time.RFC3339, scheduleReq.NewSchedule, est)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Hoagie Mail service had an error: %s", err.Error()), http.StatusNotFound)
+		response.Write(w, response.Invalid("newSchedule", "Invalid schedule of the email."))
 		return
 	}
 
 	// Check that user doesn't have an already-existing entry for the new time
 	currentScheduledMail, err = getScheduled(user, newScheduleEST)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Hoagie Mail service had an error: %s.", err.Error()), http.StatusNotFound)
+		response.Write(w, response.Internal(err))
 		return
 	}
 	if currentScheduledMail != (ScheduledMail{}) {
 		errString := "You already have an email scheduled for this time. If you would like to change"
 		errString += " your message, please delete your mail and try again."
-		http.Error(w, errString, http.StatusBadRequest)
+		response.Write(w, response.Conflict(errString))
 		return
 	}
 
 	// Perform the update operation
 	updateResult, err := db.UpdateOne(client, "apps", "mail",
 		bson.D{
-			{Key: "Email", Value: user.Email},
-			{Key: "Schedule", Value: scheduleEST},
+			{Key: "email", Value: user.Email},
+			{Key: "schedule", Value: scheduleEST},
 		},
-		bson.D{{Key: "$set", Value: bson.D{{Key: "Schedule", Value: newScheduleEST}}}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "schedule", Value: newScheduleEST}}}},
 	)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("The update operation had an error: %s", err.Error()), http.StatusBadRequest)
+		response.Write(w, response.Internal(err))
 		return
 	}
 	if updateResult.ModifiedCount < 1 {
-		http.Error(w, "Update unsuccessful. Has the email already been updated?", http.StatusBadRequest)
+		response.Write(w, response.Conflict("Update unsuccessful. Has the email already been updated?"))
+		return
 	}
 	w.Write([]byte("{\"Status\": \"OK\"}"))
 })
@@ -190,11 +189,11 @@ var scheduledSendHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.
 var scheduledUserHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 	user, success := getUser(r.Header.Get("authorization"))
 	if !success {
-		http.Error(w, "You do not have access to view scheduled mail.", http.StatusBadRequest)
+		response.Write(w, response.Unauthorized("You do not have access to view scheduled mail."))
 		return
 	}
 	if len(user.Name) == 0 {
-		http.Error(w, `Hoagie has been updated. Please log-out and log-in again.`, http.StatusBadRequest)
+		response.Write(w, response.Unauthorized(`Hoagie has been updated. Please log-out and log-in again.`))
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -202,27 +201,21 @@ var scheduledUserHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.
 	// Retrieve user's scheduled mail
 	userScheduledMail, err := getAllScheduled(user)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		response.Write(w, response.Internal(err))
 		return
 	}
-	// Create JSON response and write
-	jsonResp, err := json.Marshal(userScheduledMail)
-	if err != nil {
-		http.Error(w, "Error in json response marshalling"+err.Error(), http.StatusBadRequest)
-		return
-	}
-	w.Write(jsonResp)
+	response.JSON(w, http.StatusOK, userScheduledMail)
 })
 
 // DELETE /mail/scheduled
 var scheduledDeleteHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 	user, success := getUser(r.Header.Get("authorization"))
 	if !success {
-		http.Error(w, "You do not have access to delete this scheduled mail.", http.StatusBadRequest)
+		response.Write(w, response.Unauthorized("You do not have access to delete this scheduled mail."))
 		return
 	}
 	if len(user.Name) == 0 {
-		http.Error(w, "Hoagie has been updated. Please log-out and log-in again.", http.StatusBadRequest)
+		response.Write(w, response.Unauthorized("Hoagie has been updated. Please log-out and log-in again."))
 		return
 	}
 
@@ -230,48 +223,45 @@ var scheduledDeleteHandler = http.HandlerFunc(func(w http.ResponseWriter, r *htt
 	var scheduleReq ScheduleRequest
 	err := json.NewDecoder(r.Body).Decode(&scheduleReq)
 	if err != nil {
-		http.Error(w, "Request body doesn't contain correct fields", http.StatusBadRequest)
+		response.Write(w, response.BadRequest("Request body doesn't contain correct fields"))
 		return
 	}
 
 	// Convert time to EST and check for errors
 	est, err := time.LoadLocation("America/New_York")
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Hoagie Mail service had an error: %s", err.Error()), http.StatusNotFound)
+		response.Write(w, response.Internal(err))
 		return
 	}
 	scheduleEST, err := time.ParseInLocation(time.RFC3339, scheduleReq.Schedule, est)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Hoagie Mail service had an error: %s", err.Error()), http.StatusNotFound)
+		response.Write(w, response.Invalid("schedule", "Invalid schedule of the email."))
 		return
 	}
 
 	// Check if the specified scheduled send exists
 	currentScheduledMail, err := getScheduled(user, scheduleEST)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Hoagie Mail service had an error: %s", err.Error()), http.StatusNotFound)
+		response.Write(w, response.Internal(err))
 		return
 	}
 	if currentScheduledMail == (ScheduledMail{}) {
-		http.Error(w, "Could not find the specified email. Try refreshing the page.", http.StatusBadRequest)
+		response.Write(w, response.NotFound("Could not find the specified email. Try refreshing the page."))
 		return
 	}
 
 	// Perform the delete operation
 	deleteResult, err := db.DeleteOne(client, "apps", "mail", bson.D{
-		{Key: "Email", Value: user.Email},
-		{Key: "Schedule", Value: scheduleEST},
+		{Key: "email", Value: user.Email},
+		{Key: "schedule", Value: scheduleEST},
 	})
 	if err != nil {
-		http.Error(w, fmt.Sprintf("The delete operation had an error: %s", err.Error()), http.StatusBadRequest)
+		response.Write(w, response.Internal(err))
 		return
 	}
 	if deleteResult.DeletedCount < 1 {
-		http.Error(
-			w,
-			"Delete unsuccessful. Has the email already been deleted?",
-			http.StatusBadRequest,
-		)
+		response.Write(w, response.NotFound("Delete unsuccessful. Has the email already been deleted?"))
+		return
 	}
 	w.Write([]byte("{\"Status\": \"OK\"}"))
 })
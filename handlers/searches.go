@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hoagie-profile/config"
+	"hoagie-profile/db"
+	"hoagie-profile/response"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Search a user is alerted about whenever a matching post is created,
+// see cmd/alerts
+type SavedSearch struct {
+	Id       string `json:"id" bson:"_id,omitempty"`
+	Email    string `json:"email" bson:"email"`
+	Category string `json:"category" bson:"category"`
+	// Posts must have all of these tags
+	Tags []string `json:"tags" bson:"tags"`
+	// Every keyword must appear in the title, description or tags
+	Keywords string `json:"keywords" bson:"keywords"`
+	// Highest marketplace price in cents, if set
+	MaxPrice  *int64    `json:"maxPrice,omitempty" bson:"maxPrice,omitempty"`
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+}
+
+// Limits for saved searches
+const (
+	maxSavedSearches = 10
+	maxKeywordsChars = 100
+)
+
+// Get all saved searches of a given user, newest first
+func getSavedSearches(email string) ([]SavedSearch, error) {
+	searches := []SavedSearch{}
+
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{Key: "createdAt", Value: -1}})
+
+	resultCursor, err := db.FindMany(client, "apps", "searches", bson.D{{Key: "email", Value: email}}, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("error getting saved searches: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), REQUEST_TIMEOUT)
+	defer cancel()
+	defer resultCursor.Close(ctx)
+
+	if err := resultCursor.All(ctx, &searches); err != nil {
+		return nil, fmt.Errorf("error decoding saved searches: %s", err)
+	}
+	return searches, nil
+}
+
+// Validates a saved search, writing an error response and returning
+// false if it is invalid or would match every post
+func validateSavedSearch(w http.ResponseWriter, search *SavedSearch, taxonomy config.Taxonomy) bool {
+	if search.Category != "" && !taxonomy.IsCategory(search.Category) {
+		response.Write(w, response.Invalid("category", "Invalid category of the search."))
+		return false
+	}
+	for _, tag := range search.Tags {
+		if !validTag(taxonomy, search.Category, tag) {
+			response.Write(w, response.Invalid("tags", fmt.Sprintf("Invalid tag for this category: %s.", tag)))
+			return false
+		}
+	}
+	search.Keywords = strings.TrimSpace(search.Keywords)
+	if utf8.RuneCountInString(search.Keywords) > maxKeywordsChars {
+		response.Write(w, response.Invalid("keywords", fmt.Sprintf("Please keep your keywords under the %d-character limit.", maxKeywordsChars)))
+		return false
+	}
+	if search.MaxPrice != nil {
+		if search.Category != "" && taxonomy.Group(search.Category) != "marketplace" {
+			response.Write(w, response.Invalid("maxPrice", "Only marketplace searches can include a price cap."))
+			return false
+		}
+		if *search.MaxPrice < 0 || *search.MaxPrice > maxPriceCents {
+			response.Write(w, response.Invalid("maxPrice", fmt.Sprintf("Price cap needs to be between $0 and $%d.", maxPriceCents/100)))
+			return false
+		}
+	}
+	if search.Category == "" && len(search.Tags) == 0 && search.Keywords == "" && search.MaxPrice == nil {
+		response.Write(w, response.Invalid("keywords", "Saved searches need a category, tags, keywords or a price cap."))
+		return false
+	}
+	return true
+}
+
+// GET /stuff/searches
+var searchesUserHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	user, success := getUser(r.Header.Get("authorization"))
+	if !success {
+		response.Write(w, response.Unauthorized("You do not have access to saved searches."))
+		return
+	}
+
+	searches, err := getSavedSearches(user.Email)
+	if err != nil {
+		response.Write(w, response.Internal(err))
+		return
+	}
+
+	response.JSON(w, http.StatusOK, searches)
+})
+
+// POST /stuff/searches
+var searchSaveHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	user, success := getUser(r.Header.Get("authorization"))
+	if !success {
+		response.Write(w, response.Unauthorized("You do not have access to saved searches."))
+		return
+	}
+
+	var searchReq SavedSearch
+	if err := json.NewDecoder(r.Body).Decode(&searchReq); err != nil {
+		response.Write(w, response.BadRequest("Search did not contain correct fields."))
+		return
+	}
+	taxonomy, err := config.LoadTaxonomy(client)
+	if err != nil {
+		response.Write(w, response.Internal(err))
+		return
+	}
+	if !validateSavedSearch(w, &searchReq, taxonomy) {
+		return
+	}
+
+	count, err := db.CountDocuments(client, "apps", "searches", bson.D{{Key: "email", Value: user.Email}})
+	if err != nil {
+		response.Write(w, response.Internal(err))
+		return
+	}
+	if count >= maxSavedSearches {
+		response.Write(w, response.QuotaExceeded(fmt.Sprintf("You can only have %d saved searches. Try deleting one and save again.", maxSavedSearches)))
+		return
+	}
+
+	searchId := primitive.NewObjectID()
+	_, err = db.InsertOne(client, "apps", "searches", bson.D{
+		{Key: "_id", Value: searchId},
+		{Key: "email", Value: user.Email},
+		{Key: "category", Value: searchReq.Category},
+		{Key: "tags", Value: searchReq.Tags},
+		{Key: "keywords", Value: searchReq.Keywords},
+		{Key: "maxPrice", Value: searchReq.MaxPrice},
+		{Key: "createdAt", Value: time.Now()},
+	})
+	if err != nil {
+		response.Write(w, response.Internal(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	jsonResp, _ := json.Marshal(map[string]string{"Status": "OK", "id": searchId.Hex()})
+	w.Write(jsonResp)
+})
+
+// DELETE /stuff/searches/{id}
+var searchDeleteHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	user, success := getUser(r.Header.Get("authorization"))
+	if !success {
+		response.Write(w, response.Unauthorized("You do not have access to saved searches."))
+		return
+	}
+
+	searchId, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		response.Write(w, response.NotFound("Could not find the specified search. Try refreshing the page."))
+		return
+	}
+	deleteResult, err := db.DeleteOne(client, "apps", "searches", bson.D{
+		{Key: "_id", Value: searchId},
+		{Key: "email", Value: user.Email},
+	})
+	if err != nil {
+		response.Write(w, response.Internal(err))
+		return
+	}
+	if deleteResult.DeletedCount < 1 {
+		response.Write(w, response.NotFound("Could not find the specified search. Try refreshing the page."))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte("{\"Status\": \"OK\"}"))
+})
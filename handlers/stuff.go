@@ -4,16 +4,19 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"hoagie-profile/config"
 	"hoagie-profile/db"
-	"log"
+	"hoagie-profile/response"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 	"unicode/utf8"
 
+	"github.com/gorilla/mux"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
@@ -24,13 +27,13 @@ type UserData struct {
 }
 
 type PostData struct {
-	Id          string `json:"id"`
+	Id          string `json:"id" bson:"_id,omitempty"`
 	Title       string `json:"title"`
 	Email       string `json:"email"`
 	Description string `json:"description"`
 	// Category of the post
 	Category string `json:"category"`
-	// Imgur URL to the image
+	// ID of an image uploaded to /stuff/images, or an Imgur URL for older posts
 	Thumbnail string `json:"thumbnail"`
 	// Link to the post
 	Link string `json:"link"`
@@ -39,89 +42,294 @@ type PostData struct {
 	User   UserData `json:"user"`
 	Status string   `json:"status"`
 	// Sent with Digest or not
-	Sent bool                   `json:"sent"`
-	Info map[string]interface{} `json:"info"`
-	// TO BE REMOVED: KEPT FOR REVERSE-COMPATIBILITY WITH OLD VERSION
-	Name string `json:"name"`
+	Sent bool `json:"sent"`
+	// Digest the post was sent in, see /digests/{id}
+	DigestId string `json:"digestId,omitempty" bson:"digestId,omitempty"`
+	// Item details, only for marketplace posts
+	Marketplace *MarketplaceInfo `json:"marketplace,omitempty" bson:"marketplace,omitempty"`
+	// Details of the item, only for lost & found posts
+	LostFound *LostFoundInfo `json:"lostFound,omitempty" bson:"lostFound,omitempty"`
+	// Hides the email of the poster, who can only be reached through /stuff/{id}/contact
+	Private bool `json:"private"`
+	// Hidden from the feed by a moderator or after too many reports
+	Hidden bool `json:"hidden"`
+	// Number of reports, only shown to moderators
+	ReportCount int `json:"-" bson:"reportCount"`
+	// Edited after it was created
+	Edited    bool      `json:"edited"`
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+	// Active, resolved (sold or found) or expired
+	State     string                 `json:"state"`
+	ExpiresAt time.Time              `json:"expiresAt" bson:"expiresAt"`
+	Info      map[string]interface{} `json:"info"`
 }
 
-// All valid post categories
-var postTypes = map[string]bool{
-	"sale":        true,
-	"selling":     true,
-	"lost":        true,
-	"bulletin":    true,
-	"marketplace": true,
+type UserStuff struct {
+	Status string     `json:"status"`
+	Posts  []PostData `json:"posts"`
 }
 
-// All valid types
-var tagTypes = map[string]bool{
-	// Bulletin
-	"announcement": true,
-	"request":      true,
-	"opportunity":  true,
-	// Lost & Found
-	"lost":  true,
-	"found": true,
-	// Sale
-	"accessories": true,
-	"clothing":    true,
-	"tech":        true,
-	"furniture":   true,
-	"school":      true,
-	"tickets":     true,
-	"other":       true,
+// Returns the MongoDB ID of a post decoded from the database
+func (post PostData) objectId() primitive.ObjectID {
+	postId, _ := primitive.ObjectIDFromHex(post.Id)
+	return postId
 }
 
-var setupStuffIndex = func() error {
-	stuff := client.Database("apps").Collection("stuff")
+// Returns the query value that matches every category in the given category's group
+func categoryFilter(taxonomy config.Taxonomy, category string) interface{} {
+	return bson.D{{Key: "$in", Value: taxonomy.GroupCategories(taxonomy.Group(category))}}
+}
+
+// Get all posts of a given user, newest first
+var getUserStuff = func(email string) ([]PostData, error) {
+	var responses []PostData
 
-	model := mongo.IndexModel{
-		Keys:    bson.M{"createdAt": 1},
-		Options: options.Index().SetExpireAfterSeconds(int32(EXPIRATION_DURATION)),
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{Key: "createdAt", Value: -1}})
+
+	resultCursor, err := db.FindMany(client, "apps", "stuff", bson.D{{Key: "email", Value: email}}, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("error getting posts: %s", err)
 	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), REQUEST_TIMEOUT)
 	defer cancel()
-	stuff.Indexes().DropAll(ctx)
-	_, err := stuff.Indexes().CreateOne(ctx, model)
-	if err != nil {
-		// TODO: handle this better, errors are not necessarily bad
-		// index usually exists so this is necessary only once.
-		return err
+	defer resultCursor.Close(ctx)
+
+	if err := resultCursor.All(ctx, &responses); err != nil {
+		return nil, fmt.Errorf("error decoding posts: %s", err)
 	}
-	return nil
+	return responses, nil
 }
 
-var getCurrentDigest = func(user string) (PostData, error) {
+// Get a single post of a given user by its ID
+var getUserPost = func(email string, id string) (PostData, error) {
+	postId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return PostData{}, fmt.Errorf("invalid post ID: %s", id)
+	}
 	var response PostData
-	err := db.FindOne(client, "apps", "stuff", bson.D{{"email", user}}, &response)
+	err = db.FindOne(client, "apps", "stuff", bson.D{
+		{Key: "_id", Value: postId},
+		{Key: "email", Value: email},
+	}, &response)
 	if err != nil {
-		return PostData{}, fmt.Errorf("error getting digest: %s", err)
+		return PostData{}, fmt.Errorf("error getting post: %s", err)
 	}
-	response.Status = "used"
 	return response, nil
 }
 
-var getAllStuff = func(limit int64, skip int64, category string) ([]PostData, error) {
-	var responses []PostData
+// Filters for the posts returned by GET /stuff
+type StuffQuery struct {
+	Limit    int64
+	Skip     int64
+	Category string
+	// Every category of the group of Category
+	Categories []string
+	// Full-text search terms, results are ordered by relevance
+	Search string
+	// Posts must have all of these tags
+	Tags []string
+	// Posts must be created at or after From and before To, if set
+	From time.Time
+	To   time.Time
+	// Return a page with a cursor instead of using the offset
+	Paginate bool
+	// Position after which the page starts, nil for the first page
+	After *stuffCursor
+	// Marketplace price range in cents, if set
+	MinPrice *int64
+	MaxPrice *int64
+	// Order of the results: "newest" (default), "price" or "-price"
+	Sort string
+}
 
-	// Setup options for database search
-	findOptions := options.Find()
-	findOptions.SetSort(bson.D{
-		{"createdAt", -1},
-		// {"category", category},
-	})
-	findOptions.SetLimit(limit)
-	findOptions.SetSkip(skip)
+// All valid orders of the results of GET /stuff
+var sortTypes = map[string]bool{
+	"newest": true,
+	"price":  true,
+	"-price": true,
+}
+
+// Default page size when paginating with cursors without a limit
+const defaultPageSize = 20
+
+// Accepted formats for the from and to query parameters
+const queryDayLayout = "2006-01-02"
+
+var queryDateLayouts = []string{time.RFC3339, queryDayLayout}
+
+// Parses a date, in Princeton time unless it has a time zone. Returns
+// whether only the day was given.
+func parseQueryDate(value string) (time.Time, bool, error) {
+	est, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	for _, layout := range queryDateLayouts {
+		if date, err := time.ParseInLocation(layout, value, est); err == nil {
+			return date, layout == queryDayLayout, nil
+		}
+	}
+	return time.Time{}, false, fmt.Errorf("invalid date: %s", value)
+}
 
-	query := bson.D{}
-	if category != "" {
-		if category == "marketplace" {
-			query = bson.D{{"category", bson.D{{"$in", []string{"sale", "selling"}}}}}
+// Parse and validate the query parameters of GET /stuff
+func parseStuffQuery(values url.Values, taxonomy config.Taxonomy) (StuffQuery, error) {
+	var query StuffQuery
+	var err error
+
+	// Passing a cursor, even an empty one for the first page, switches
+	// from offset-based to cursor-based pagination
+	query.Paginate = values.Has("cursor")
+	if query.Paginate {
+		query.Limit = defaultPageSize
+		if token := values.Get("cursor"); token != "" {
+			after, err := decodeStuffCursor(token)
+			if err != nil {
+				return query, err
+			}
+			query.After = &after
+		}
+	}
+
+	if limit := values.Get("limit"); limit != "" || !query.Paginate {
+		query.Limit, err = strconv.ParseInt(limit, 10, 64)
+		if err != nil || query.Limit < 0 || (query.Paginate && query.Limit == 0) {
+			return query, fmt.Errorf("invalid limit")
+		}
+	}
+	if !query.Paginate {
+		query.Skip, err = strconv.ParseInt(values.Get("offset"), 10, 64)
+		if err != nil {
+			return query, fmt.Errorf("invalid offset")
+		}
+	}
+
+	// Ensure selected category, if present, is valid
+	query.Category = values.Get("category")
+	if !taxonomy.IsCategory(query.Category) && len(query.Category) > 0 {
+		return query, fmt.Errorf("invalid category")
+	}
+	query.Categories = taxonomy.GroupCategories(taxonomy.Group(query.Category))
+
+	// Tags can be repeated or given as a comma-separated list, and need
+	// to belong to the selected category
+	for _, tagList := range values["tag"] {
+		for _, tag := range strings.Split(tagList, ",") {
+			if !validTag(taxonomy, query.Category, tag) {
+				return query, fmt.Errorf("invalid tag")
+			}
+			query.Tags = append(query.Tags, tag)
+		}
+	}
+
+	if from := values.Get("from"); from != "" {
+		if query.From, _, err = parseQueryDate(from); err != nil {
+			return query, err
+		}
+	}
+	// A day includes every post created on it, and a time includes posts
+	// created at that time, which MongoDB stores to the millisecond
+	if to := values.Get("to"); to != "" {
+		to, dayOnly, err := parseQueryDate(to)
+		if err != nil {
+			return query, err
+		}
+		if dayOnly {
+			query.To = to.AddDate(0, 0, 1)
 		} else {
-			query = bson.D{{"category", category}}
+			query.To = to.Truncate(time.Millisecond).Add(time.Millisecond)
+		}
+	}
+
+	query.Search = strings.TrimSpace(values.Get("q"))
+	if utf8.RuneCountInString(query.Search) > 100 {
+		return query, fmt.Errorf("search query is too long")
+	}
+
+	if minPrice := values.Get("minPrice"); minPrice != "" {
+		price, err := parsePrice(minPrice)
+		if err != nil {
+			return query, err
 		}
+		query.MinPrice = &price
 	}
+	if maxPrice := values.Get("maxPrice"); maxPrice != "" {
+		price, err := parsePrice(maxPrice)
+		if err != nil {
+			return query, err
+		}
+		query.MaxPrice = &price
+	}
+
+	query.Sort = values.Get("sort")
+	if query.Sort == "" {
+		query.Sort = "newest"
+	}
+	if !sortTypes[query.Sort] {
+		return query, fmt.Errorf("invalid sort")
+	}
+	// Cursors only encode a position in the newest-first feed
+	if query.Paginate && query.Sort != "newest" {
+		return query, fmt.Errorf("sort is not supported with cursors")
+	}
+	return query, nil
+}
+
+// Build the MongoDB filter matching every condition of a query
+func (query StuffQuery) filter() bson.D {
+	filter := visibleStuffFilter()
+	if query.Category != "" {
+		filter = append(filter, bson.E{Key: "category", Value: bson.D{{Key: "$in", Value: query.Categories}}})
+	}
+	if len(query.Tags) > 0 {
+		filter = append(filter, bson.E{Key: "tags", Value: bson.D{{Key: "$all", Value: query.Tags}}})
+	}
+	if !query.From.IsZero() || !query.To.IsZero() {
+		createdAt := bson.D{}
+		if !query.From.IsZero() {
+			createdAt = append(createdAt, bson.E{Key: "$gte", Value: query.From})
+		}
+		if !query.To.IsZero() {
+			createdAt = append(createdAt, bson.E{Key: "$lt", Value: query.To})
+		}
+		filter = append(filter, bson.E{Key: "createdAt", Value: createdAt})
+	}
+	if query.MinPrice != nil || query.MaxPrice != nil {
+		price := bson.D{}
+		if query.MinPrice != nil {
+			price = append(price, bson.E{Key: "$gte", Value: *query.MinPrice})
+		}
+		if query.MaxPrice != nil {
+			price = append(price, bson.E{Key: "$lte", Value: *query.MaxPrice})
+		}
+		filter = append(filter, bson.E{Key: "marketplace.price", Value: price})
+	}
+	if query.Search != "" {
+		filter = append(filter, bson.E{Key: "$text", Value: bson.D{{Key: "$search", Value: query.Search}}})
+	}
+	return filter
+}
+
+var getAllStuff = func(stuffQuery StuffQuery) ([]PostData, error) {
+	var responses []PostData
+
+	// Setup options for database search, most relevant first when searching
+	findOptions := options.Find()
+	sort := bson.D{{Key: "createdAt", Value: -1}}
+	if stuffQuery.Sort == "price" {
+		sort = append(bson.D{{Key: "marketplace.price", Value: 1}}, sort...)
+	} else if stuffQuery.Sort == "-price" {
+		sort = append(bson.D{{Key: "marketplace.price", Value: -1}}, sort...)
+	} else if stuffQuery.Search != "" {
+		sort = append(bson.D{{Key: "score", Value: bson.D{{Key: "$meta", Value: "textScore"}}}}, sort...)
+	}
+	findOptions.SetSort(sort)
+	findOptions.SetLimit(stuffQuery.Limit)
+	findOptions.SetSkip(stuffQuery.Skip)
+
+	query := stuffQuery.filter()
 	// Perform database search
 	resultCursor, err := db.FindMany(client, "apps", "stuff", query, findOptions)
 	if err != nil {
@@ -149,39 +357,109 @@ var getAllStuff = func(limit int64, skip int64, category string) ([]PostData, er
 	return responses, nil
 }
 
+// Removes the contact details of private posts, whose posters can
+// only be reached through the contact relay
+func hidePrivateContacts(posts []PostData) {
+	for i := range posts {
+		if posts[i].Private {
+			posts[i].Email = ""
+			posts[i].User.Email = ""
+			posts[i].User.Phone = ""
+		}
+	}
+}
+
+// Returns whether a tag can be used with the given category, or with any
+// category if none is given
+func validTag(taxonomy config.Taxonomy, category string, tag string) bool {
+	if category == "" {
+		return taxonomy.IsTag(tag)
+	}
+	return taxonomy.AllowsTag(category, tag)
+}
+
+// Validates the category, tags, title, description and link of a post,
+// writing an error response and returning false if any of them are invalid
+func validatePost(w http.ResponseWriter, postReq PostData, taxonomy config.Taxonomy) bool {
+	// Ensure type of post is valid
+	if !taxonomy.IsCategory(postReq.Category) {
+		response.Write(w, response.Invalid("category", "Invalid category of the post."))
+		return false
+	}
+
+	// Ensure that tags are valid for the category
+	for _, tag := range postReq.Tags {
+		if !taxonomy.AllowsTag(postReq.Category, tag) {
+			response.Write(w, response.Invalid("tags", fmt.Sprintf("Invalid tag for this category: %s.", tag)))
+			return false
+		}
+	}
+
+	// Title length. The rules follow the group of the category, so that
+	// legacy and renamed categories keep the rules of their group.
+	group := taxonomy.Group(postReq.Category)
+	if group == "bulletin" || group == "lost" {
+		if utf8.RuneCountInString(postReq.Title) < 3 || utf8.RuneCountInString(postReq.Title) > 100 {
+			response.Write(w, response.Invalid("title", "Title needs to be between 3 and 100 characters inclusive."))
+			return false
+		}
+	}
+
+	// Description Length
+	if utf8.RuneCountInString(postReq.Description) < 3 || utf8.RuneCountInString(postReq.Description) > 300 {
+		response.Write(w, response.Invalid("description", "Description needs to be between 3 and 300 characters inclusive."))
+		return false
+	}
+
+	// Link
+	if len(postReq.Link) > 0 {
+		if group == "lost" {
+			if !strings.HasPrefix(postReq.Link, "https://i.imgur.com/") {
+				response.Write(w, response.Invalid("link", "Link must be a valid Imgur URL."))
+				return false
+			}
+		} else if group == "marketplace" {
+			if !strings.HasPrefix(postReq.Link, "https://docs.google.com/") {
+				response.Write(w, response.Invalid("link", "Link must be a valid Google Slides URL."))
+				return false
+			}
+		} else {
+			response.Write(w, response.Invalid("link", "You cannot include links in this category."))
+			return false
+		}
+	}
+	return true
+}
+
 // GET /stuff/user
 var stuffUserHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 	user, success := getUser(r.Header.Get("authorization"))
 
 	if !success {
-		http.Error(w, "You do not have access to send digest.", http.StatusBadRequest)
+		response.Write(w, response.Unauthorized("You do not have access to send digest."))
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	currentDigest, err := getCurrentDigest(user.Email)
+	posts, err := getUserStuff(user.Email)
 	if err != nil {
-		result, _ := json.Marshal(map[string]string{"status": "unused"})
-		w.Write(result)
+		response.Write(w, response.Internal(err))
 		return
 	}
 
-	// Construct user data
-	var userData UserData
-	userData.Email = user.Email
-	userData.Name = user.Name
-
-	// Construct currentDigest
-	currentDigest.User = userData
-	currentDigest.Status = "used"
-
-	// Create JSON response
-	jsonResp, err := json.Marshal(currentDigest)
-
-	if err != nil {
-		log.Fatalf("Error happened in response marshalling. %s", err)
+	userStuff := UserStuff{Status: "unused", Posts: []PostData{}}
+	for _, post := range posts {
+		// Construct user data
+		post.User.Email = user.Email
+		post.User.Name = user.Name
+		post.Status = "used"
+		post.State = post.currentState()
+		userStuff.Posts = append(userStuff.Posts, post)
 	}
-	w.Write(jsonResp)
+	if len(userStuff.Posts) > 0 {
+		userStuff.Status = "used"
+	}
+
+	response.JSON(w, http.StatusOK, userStuff)
 })
 
 // GET /stuff
@@ -189,59 +467,84 @@ var stuffAllHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Reque
 	_, success := getUser(r.Header.Get("authorization"))
 
 	if !success {
-		http.Error(w, "You do not have access to the Hoagie API.", http.StatusBadRequest)
+		response.Write(w, response.Unauthorized("You do not have access to the Hoagie API."))
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	// vars := mux.Vars(r)
-	// fmt.Println(vars)
-	// limit, limitErr := strconv.ParseInt(vars["limit"], 10, 64)
-	// println(limit, limitErr)
-	// skip, skipErr := strconv.ParseInt(vars["offset"], 10, 64)
-	// println(skip, skipErr)
-	limit, limitErr := strconv.ParseInt(r.URL.Query().Get("limit"), 10, 64)
-	skip, skipErr := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
-
-	category := r.URL.Query().Get("category")
-	categoryErr := false
-
-	// Ensure selected category, if present, is valid
-	if !postTypes[category] && len(category) > 0 {
-		categoryErr = true
+	taxonomy, err := config.LoadTaxonomy(client)
+	if err != nil {
+		response.Write(w, response.Internal(err))
+		return
 	}
-
-	if limitErr != nil || skipErr != nil || categoryErr {
-		http.Error(w, "Error parsing query parameters.", http.StatusBadRequest)
+	stuffQuery, err := parseStuffQuery(r.URL.Query(), taxonomy)
+	if err != nil {
+		response.Write(w, response.BadRequest(fmt.Sprintf("Error parsing query parameters: %s.", err.Error())))
 		return
 	}
 
 	// Retrieve relevant data
-	allStuff, err := getAllStuff(limit, skip, category)
+	var stuffResp interface{}
+	if stuffQuery.Paginate {
+		var page StuffPage
+		page, err = getStuffPage(stuffQuery)
+		hidePrivateContacts(page.Posts)
+		stuffResp = page
+	} else {
+		var posts []PostData
+		posts, err = getAllStuff(stuffQuery)
+		hidePrivateContacts(posts)
+		stuffResp = posts
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		response.Write(w, response.Internal(err))
 		return
 	}
+	response.JSON(w, http.StatusOK, stuffResp)
+})
 
-	// Create JSON response
-	jsonResp, err := json.Marshal(allStuff)
-
+// Ensure the user has not reached their quota for the group of the category,
+// not counting the post with the given ID, if any
+func withinQuota(
+	w http.ResponseWriter,
+	email string,
+	category string,
+	exceptId primitive.ObjectID,
+	stuffConfig config.Stuff,
+	taxonomy config.Taxonomy,
+) bool {
+	group := taxonomy.Group(category)
+	quota := stuffConfig.QuotaFor(group)
+	filter := append(bson.D{
+		{Key: "email", Value: email},
+		{Key: "category", Value: categoryFilter(taxonomy, category)},
+	}, activeStuffFilter()...)
+	if !exceptId.IsZero() {
+		filter = append(filter, bson.E{Key: "_id", Value: bson.D{{Key: "$ne", Value: exceptId}}})
+	}
+	count, err := db.CountDocuments(client, "apps", "stuff", filter)
 	if err != nil {
-		log.Fatalf("Error happened in response marshalling. %s", err)
+		response.Write(w, response.Internal(err))
+		return false
 	}
-	w.Write(jsonResp)
-})
+	if count >= int64(quota) {
+		response.Write(w, response.QuotaExceeded(fmt.Sprintf("You can only have %d %s post(s) at a time. Try deleting one and send again.", quota, group)))
+		return false
+	}
+	return true
+}
 
 // POST /stuff
 var stuffSendHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 	user, success := getUser(r.Header.Get("authorization"))
 	if !success {
-		http.Error(w, "You do not have access to send mail.", http.StatusBadRequest)
+		response.Write(w, response.Unauthorized("You do not have access to send mail."))
 		return
 	}
 
 	if len(user.Name) == 0 {
-		http.Error(w, `Hoagie has been updated. Please log-out and log-in again.`, http.StatusBadRequest)
+		response.Write(w, response.Unauthorized(`Hoagie has been updated. Please log-out and log-in again.`))
+		return
 	}
 
 	var postReq PostData
@@ -252,116 +555,205 @@ var stuffSendHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Requ
 	postReq.Sent = false
 
 	if err != nil {
-		http.Error(w, "Message did not contain correct fields.", http.StatusBadRequest)
+		response.Write(w, response.BadRequest("Message did not contain correct fields."))
 		deleteVisitor(user.Email)
 		return
 	}
 
-	// Validation here
-	// Ensure type of post is valid
-	if !postTypes[postReq.Category] {
-		http.Error(w, "Invalid category of the post.", http.StatusBadRequest)
+	taxonomy, err := config.LoadTaxonomy(client)
+	if err != nil {
+		response.Write(w, response.Internal(err))
 		deleteVisitor(user.Email)
 		return
 	}
-
-	// Ensure that tags are valid
-	var numTags int = len(postReq.Tags)
-	for i := 0; i < numTags; i++ {
-		if !tagTypes[postReq.Tags[i]] {
-			http.Error(w, "Invalid tag used.", http.StatusBadRequest)
-			deleteVisitor(user.Email)
-			return
-		}
-	}
-
-	// Title length
-	if postReq.Category == "bulletin" || postReq.Category == "lost" {
-		if utf8.RuneCountInString(postReq.Title) < 3 || utf8.RuneCountInString(postReq.Title) > 100 {
-			http.Error(w, "Title needs to be between 3 and 100 characters inclusive.", http.StatusBadRequest)
-			deleteVisitor(user.Email)
-			return
-		}
+	if !validatePost(w, postReq, taxonomy) || !validateMarketplace(w, &postReq, taxonomy) || !validateLostFound(w, &postReq, taxonomy) || !validateThumbnail(w, user.Email, postReq.Thumbnail) {
+		deleteVisitor(user.Email)
+		return
 	}
 
-	// Description Length
-	if utf8.RuneCountInString(postReq.Description) < 3 || utf8.RuneCountInString(postReq.Description) > 300 {
-		http.Error(w, "Description needs to be between 3 and 200 characters inclusive.", http.StatusBadRequest)
+	// Ensure the user has not reached their quota for this category
+	stuffConfig, err := config.LoadStuff(client)
+	if err != nil {
+		response.Write(w, response.Internal(err))
 		deleteVisitor(user.Email)
 		return
 	}
-
-	// Link
-	if len(postReq.Link) > 0 {
-		if postReq.Category == "lost" {
-			if !strings.HasPrefix(postReq.Link, "https://i.imgur.com/") {
-				http.Error(w, "Link must be a valid Imgur URL.", http.StatusBadRequest)
-				deleteVisitor(user.Email)
-				return
-			}
-		} else if postReq.Category == "sale" {
-			if !strings.HasPrefix(postReq.Link, "https://docs.google.com/") {
-				http.Error(w, "Link must be a valid Google Slides URL.", http.StatusBadRequest)
-				deleteVisitor(user.Email)
-				return
-			}
-		} else {
-			http.Error(w, "You cannot include links in this category.", http.StatusBadRequest)
-			deleteVisitor(user.Email)
-			return
-		}
+	if !withinQuota(w, user.Email, postReq.Category, primitive.NilObjectID, stuffConfig, taxonomy) {
+		deleteVisitor(user.Email)
+		return
 	}
 
-	current, _ := getCurrentDigest(user.Email)
-	if current.Title != "" {
-		http.Error(w, "You have already an existing digest. Try deleting it and send again.", http.StatusBadRequest)
+	createdAt := time.Now()
+	expiresAt, ok := postExpiration(w, postReq, createdAt, stuffConfig, taxonomy)
+	if !ok {
 		deleteVisitor(user.Email)
 		return
 	}
 
 	// Add the digest request to the user's digest queue; the MongoDB document decomposes PostData and UserData
 	// into their constitutent elements
-	db.InsertOne(client, "apps", "stuff", bson.D{
-		{"email", user.Email},
-		{"user", postReq.User},
-		{"id", postReq.Id},
-		{"title", postReq.Title},
-		{"description", postReq.Description},
-		{"thumbnail", postReq.Thumbnail},
-		{"category", postReq.Category},
-		{"link", postReq.Link},
-		{"tags", postReq.Tags},
-		{"sent", postReq.Sent},
-		{"createdAt", time.Now()},
+	postId := primitive.NewObjectID()
+	_, err = db.InsertOne(client, "apps", "stuff", bson.D{
+		{Key: "_id", Value: postId},
+		{Key: "email", Value: user.Email},
+		{Key: "user", Value: postReq.User},
+		{Key: "title", Value: postReq.Title},
+		{Key: "description", Value: postReq.Description},
+		{Key: "thumbnail", Value: postReq.Thumbnail},
+		{Key: "category", Value: postReq.Category},
+		{Key: "link", Value: postReq.Link},
+		{Key: "tags", Value: postReq.Tags},
+		{Key: "marketplace", Value: postReq.Marketplace},
+		{Key: "lostFound", Value: postReq.LostFound},
+		{Key: "private", Value: postReq.Private},
+		{Key: "sent", Value: postReq.Sent},
+		// Picked up by the saved search alerts in cmd/alerts
+		{Key: "alerted", Value: false},
+		{Key: "state", Value: stateActive},
+		{Key: "createdAt", Value: createdAt},
+		{Key: "expiresAt", Value: expiresAt},
 	})
+	if err != nil {
+		response.Write(w, response.Internal(err))
+		deleteVisitor(user.Email)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	jsonResp, _ := json.Marshal(map[string]string{"Status": "OK", "id": postId.Hex()})
+	w.Write(jsonResp)
+})
+
+// PUT /stuff/user/{id}
+var stuffEditHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	user, success := getUser(r.Header.Get("authorization"))
+	if !success {
+		response.Write(w, response.Unauthorized("You do not have access to edit this post."))
+		return
+	}
+
+	var postReq PostData
+	err := json.NewDecoder(r.Body).Decode(&postReq)
+	if err != nil {
+		response.Write(w, response.BadRequest("Message did not contain correct fields."))
+		return
+	}
+
+	taxonomy, err := config.LoadTaxonomy(client)
+	if err != nil {
+		response.Write(w, response.Internal(err))
+		return
+	}
+	if !validatePost(w, postReq, taxonomy) || !validateMarketplace(w, &postReq, taxonomy) || !validateLostFound(w, &postReq, taxonomy) {
+		return
+	}
+
+	current, err := getUserPost(user.Email, mux.Vars(r)["id"])
+	if err != nil {
+		response.Write(w, response.NotFound("Could not find the specified post. Try refreshing the page."))
+		return
+	}
+
+	// Older posts may keep their Imgur thumbnail
+	if postReq.Thumbnail != current.Thumbnail && !validateThumbnail(w, user.Email, postReq.Thumbnail) {
+		return
+	}
+
+	// Posts that already went out with a digest can no longer be changed,
+	// otherwise the feed would no longer match what was emailed
+	if current.Sent {
+		response.Write(w, response.Conflict("Your post has already been sent with a digest and can no longer be edited."))
+		return
+	}
+	if current.State == stateResolved {
+		response.Write(w, response.Conflict("Your post has already been marked as resolved and can no longer be edited."))
+		return
+	}
+
+	// The expiration bounds stay relative to when the post was created
+	stuffConfig, err := config.LoadStuff(client)
+	if err != nil {
+		response.Write(w, response.Internal(err))
+		return
+	}
+	postReq.ExpiresAt = editedExpiration(postReq, current, taxonomy)
+	expiresAt, ok := postExpiration(w, postReq, current.CreatedAt, stuffConfig, taxonomy)
+	if !ok {
+		return
+	}
+
+	// Moving the post to another group counts against the quota of that group
+	if taxonomy.Group(postReq.Category) != taxonomy.Group(current.Category) &&
+		!withinQuota(w, user.Email, postReq.Category, current.objectId(), stuffConfig, taxonomy) {
+		return
+	}
+
+	// Keep createdAt untouched so the post keeps its position in the feed
+	updateResult, err := db.UpdateOne(client, "apps", "stuff",
+		bson.D{
+			{Key: "_id", Value: current.objectId()},
+			{Key: "email", Value: user.Email},
+			{Key: "sent", Value: false},
+		},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "title", Value: postReq.Title},
+			{Key: "description", Value: postReq.Description},
+			{Key: "thumbnail", Value: postReq.Thumbnail},
+			{Key: "category", Value: postReq.Category},
+			{Key: "link", Value: postReq.Link},
+			{Key: "tags", Value: postReq.Tags},
+			{Key: "marketplace", Value: postReq.Marketplace},
+			{Key: "lostFound", Value: postReq.LostFound},
+			{Key: "private", Value: postReq.Private},
+			{Key: "expiresAt", Value: expiresAt},
+			{Key: "edited", Value: true},
+			{Key: "updatedAt", Value: time.Now()},
+		}}},
+	)
+	if err != nil {
+		response.Write(w, response.Internal(err))
+		return
+	}
+	if updateResult.MatchedCount < 1 {
+		response.Write(w, response.Conflict("Your post has already been sent with a digest and can no longer be edited."))
+		return
+	}
+	if postReq.Thumbnail != current.Thumbnail {
+		if err := releaseThumbnail(current.Thumbnail, current.objectId()); err != nil {
+			fmt.Println("Error deleting replaced image:", err)
+		}
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.Write([]byte("{\"Status\": \"OK\"}"))
 })
 
-// DELETE /stuff/user
+// DELETE /stuff/user/{id}
 var stuffDeleteHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 	user, success := getUser(r.Header.Get("authorization"))
 	if !success {
-		http.Error(w, "You do not have access to send mail.", http.StatusBadRequest)
+		response.Write(w, response.Unauthorized("You do not have access to send mail."))
 		return
 	}
 
-	current, _ := getCurrentDigest(user.Email)
-	if current.Category == "" {
-		http.Error(w, "You do not have an existing digest message. Please create one first.", http.StatusBadRequest)
+	current, err := getUserPost(user.Email, mux.Vars(r)["id"])
+	if err != nil {
+		response.Write(w, response.NotFound("Could not find the specified post. Try refreshing the page."))
 		deleteVisitor(user.Email)
 		return
 	}
 
 	// Remove the digest request from the user's digest queue
-	_, err := db.DeleteOne(client, "apps", "stuff", bson.D{
-		{"email", user.Email},
+	_, err = db.DeleteOne(client, "apps", "stuff", bson.D{
+		{Key: "_id", Value: current.objectId()},
+		{Key: "email", Value: user.Email},
 	})
 	if err != nil {
-		http.Error(w, "You do not have an existing digest message.", http.StatusBadRequest)
+		response.Write(w, response.Internal(err))
 		deleteVisitor(user.Email)
 		return
 	}
+	if err := releaseThumbnail(current.Thumbnail, current.objectId()); err != nil {
+		fmt.Println("Error deleting image of deleted post:", err)
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.Write([]byte("{\"Status\": \"OK\"}"))
 })
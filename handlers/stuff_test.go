@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"hoagie-profile/config"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestParseStuffQuery(t *testing.T) {
+	est, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cursor := encodeStuffCursor(PostData{Id: primitive.NewObjectID().Hex(), CreatedAt: time.Now()})
+
+	tests := []struct {
+		name  string
+		query string
+		check func(t *testing.T, query StuffQuery)
+	}{
+		{
+			name:  "offset",
+			query: "limit=10&offset=20",
+			check: func(t *testing.T, query StuffQuery) {
+				if query.Limit != 10 || query.Skip != 20 || query.Paginate || query.Sort != "newest" {
+					t.Errorf("query = %+v", query)
+				}
+			},
+		},
+		{
+			name:  "first page",
+			query: "cursor=",
+			check: func(t *testing.T, query StuffQuery) {
+				if !query.Paginate || query.Limit != defaultPageSize || query.After != nil {
+					t.Errorf("query = %+v", query)
+				}
+			},
+		},
+		{
+			name:  "next page",
+			query: "cursor=" + cursor + "&limit=5",
+			check: func(t *testing.T, query StuffQuery) {
+				if !query.Paginate || query.Limit != 5 || query.After == nil {
+					t.Errorf("query = %+v", query)
+				}
+			},
+		},
+		{
+			name:  "group of a legacy category",
+			query: "limit=0&offset=0&category=selling",
+			check: func(t *testing.T, query StuffQuery) {
+				if strings.Join(query.Categories, ",") != "sale,selling,marketplace" {
+					t.Errorf("categories = %v", query.Categories)
+				}
+			},
+		},
+		{
+			name:  "repeated and comma-separated tags",
+			query: "limit=0&offset=0&category=sale&tag=tech,furniture&tag=school",
+			check: func(t *testing.T, query StuffQuery) {
+				if strings.Join(query.Tags, ",") != "tech,furniture,school" {
+					t.Errorf("tags = %v", query.Tags)
+				}
+			},
+		},
+		{
+			name:  "tag of any category",
+			query: "limit=0&offset=0&tag=found",
+			check: func(t *testing.T, query StuffQuery) {
+				if len(query.Tags) != 1 {
+					t.Errorf("tags = %v", query.Tags)
+				}
+			},
+		},
+		{
+			name:  "days include the whole to day",
+			query: "limit=0&offset=0&from=2024-03-01&to=2024-03-05",
+			check: func(t *testing.T, query StuffQuery) {
+				if want := time.Date(2024, time.March, 1, 0, 0, 0, 0, est); !query.From.Equal(want) {
+					t.Errorf("from = %s, want %s", query.From, want)
+				}
+				lastPost := time.Date(2024, time.March, 5, 23, 59, 59, 0, est)
+				if !lastPost.Before(query.To) {
+					t.Errorf("to = %s excludes a post at %s", query.To, lastPost)
+				}
+				if nextDay := time.Date(2024, time.March, 6, 0, 0, 0, 0, est); query.To.After(nextDay) {
+					t.Errorf("to = %s includes the next day", query.To)
+				}
+			},
+		},
+		{
+			name:  "times include posts at the to time",
+			query: "limit=0&offset=0&to=2024-03-05T12:00:00Z",
+			check: func(t *testing.T, query StuffQuery) {
+				at := time.Date(2024, time.March, 5, 12, 0, 0, 0, time.UTC)
+				if !at.Before(query.To) || query.To.After(at.Add(time.Second)) {
+					t.Errorf("to = %s, want just after %s", query.To, at)
+				}
+			},
+		},
+		{
+			name:  "prices in dollars",
+			query: "limit=0&offset=0&minPrice=5&maxPrice=12.50&sort=-price",
+			check: func(t *testing.T, query StuffQuery) {
+				if *query.MinPrice != 500 || *query.MaxPrice != 1250 || query.Sort != "-price" {
+					t.Errorf("prices = %d to %d sorted by %s", *query.MinPrice, *query.MaxPrice, query.Sort)
+				}
+			},
+		},
+		{
+			name:  "prices above the highest price",
+			query: "limit=0&offset=0&maxPrice=1e300",
+			check: func(t *testing.T, query StuffQuery) {
+				if *query.MaxPrice != maxPriceCents {
+					t.Errorf("max price = %d, want %d", *query.MaxPrice, maxPriceCents)
+				}
+			},
+		},
+		{
+			name:  "search",
+			query: "limit=0&offset=0&q=+blue+bottle+",
+			check: func(t *testing.T, query StuffQuery) {
+				if query.Search != "blue bottle" {
+					t.Errorf("search = %q", query.Search)
+				}
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values, err := url.ParseQuery(test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			query, err := parseStuffQuery(values, config.DefaultTaxonomy())
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.check(t, query)
+		})
+	}
+}
+
+func TestParseStuffQueryRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"missing limit", "offset=0"},
+		{"missing offset", "limit=10"},
+		{"negative limit", "limit=-1&offset=0"},
+		{"empty page", "cursor=&limit=0"},
+		{"invalid cursor", "cursor=abc"},
+		{"unknown category", "limit=0&offset=0&category=housing"},
+		{"tag of another category", "limit=0&offset=0&category=lost&tag=tech"},
+		{"unknown tag", "limit=0&offset=0&tag=cars"},
+		{"invalid from", "limit=0&offset=0&from=yesterday"},
+		{"invalid to", "limit=0&offset=0&to=2024-13-01"},
+		{"negative price", "limit=0&offset=0&minPrice=-5"},
+		{"NaN price", "limit=0&offset=0&maxPrice=NaN"},
+		{"infinite price", "limit=0&offset=0&maxPrice=Inf"},
+		{"unknown sort", "limit=0&offset=0&sort=oldest"},
+		{"price sort with cursors", "cursor=&sort=price"},
+		{"long search", "limit=0&offset=0&q=" + strings.Repeat("a", 101)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values, err := url.ParseQuery(test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := parseStuffQuery(values, config.DefaultTaxonomy()); err == nil {
+				t.Errorf("parseStuffQuery(%q) succeeded, want an error", test.query)
+			}
+		})
+	}
+}
+
+func TestInactiveThumbnailFilterCoversResolvedPosts(t *testing.T) {
+	filter := inactiveThumbnailFilter().Map()
+	nor, ok := filter["$nor"].(bson.A)
+	if !ok || len(nor) != 1 {
+		t.Fatalf("$nor = %v, want the active post filter", filter["$nor"])
+	}
+	active := nor[0].(bson.D).Map()
+	if _, ok := active["state"]; !ok {
+		t.Errorf("inactive filter %v does not cover resolved posts", nor[0])
+	}
+}
+
+func TestEditedExpiration(t *testing.T) {
+	taxonomy := config.DefaultTaxonomy()
+	current := PostData{Category: "sale", ExpiresAt: time.Date(2026, 5, 20, 0, 0, 0, 0, time.UTC)}
+	chosen := time.Date(2026, 5, 10, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		postReq PostData
+		want    time.Time
+	}{
+		{"kept when not given", PostData{Category: "sale"}, current.ExpiresAt},
+		{"replaced when given", PostData{Category: "sale", ExpiresAt: chosen}, chosen},
+		{"default in another group", PostData{Category: "lost"}, time.Time{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := editedExpiration(test.postReq, current, taxonomy); !got.Equal(test.want) {
+				t.Errorf("editedExpiration = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"hoagie-profile/config"
+	"hoagie-profile/db"
+	"hoagie-profile/digest"
+	"hoagie-profile/mail"
+	"hoagie-profile/response"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Personal digest of the chosen sections, see digest.SendPersonal
+type Subscription struct {
+	Id    string `json:"id" bson:"_id,omitempty"`
+	Email string `json:"email" bson:"email"`
+	// Digest sections to include: lost, sale and bulletin
+	Sections []string `json:"sections" bson:"sections"`
+	// Every digest ("each") or once a week ("weekly")
+	Frequency string    `json:"frequency" bson:"frequency"`
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+}
+
+// Ensure a subscription has known sections and frequency
+func validateSubscription(w http.ResponseWriter, subscription *Subscription, taxonomy config.Taxonomy) bool {
+	if len(subscription.Sections) == 0 {
+		response.Write(w, response.Invalid("sections", "Choose at least one section of the digest."))
+		return false
+	}
+	seen := map[string]bool{}
+	var sections []string
+	for _, section := range subscription.Sections {
+		if !taxonomy.IsSection(section) {
+			response.Write(w, response.Invalid("sections", fmt.Sprintf("Invalid digest section: %s.", section)))
+			return false
+		}
+		if !seen[section] {
+			seen[section] = true
+			sections = append(sections, section)
+		}
+	}
+	subscription.Sections = sections
+	if subscription.Frequency != digest.FrequencyEach && subscription.Frequency != digest.FrequencyWeekly {
+		response.Write(w, response.Invalid("frequency", "Digest frequency must be each or weekly."))
+		return false
+	}
+	return true
+}
+
+// GET /digest/subscription
+var subscriptionHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	user, success := getUser(r.Header.Get("authorization"))
+	if !success {
+		response.Write(w, response.Unauthorized("You do not have access to digest subscriptions."))
+		return
+	}
+
+	var subscription Subscription
+	err := db.FindOne(client, "apps", "subscriptions", bson.D{{Key: "email", Value: user.Email}}, &subscription)
+	if err == mongo.ErrNoDocuments {
+		response.Write(w, response.NotFound("You are not subscribed to the digest."))
+		return
+	} else if err != nil {
+		response.Write(w, response.Internal(err))
+		return
+	}
+
+	response.JSON(w, http.StatusOK, subscription)
+})
+
+// PUT /digest/subscription subscribes the user, or changes their subscription
+var subscriptionUpdateHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	user, success := getUser(r.Header.Get("authorization"))
+	if !success {
+		response.Write(w, response.Unauthorized("You do not have access to digest subscriptions."))
+		return
+	}
+
+	var subscriptionReq Subscription
+	if err := json.NewDecoder(r.Body).Decode(&subscriptionReq); err != nil {
+		response.Write(w, response.BadRequest("Subscription did not contain correct fields."))
+		return
+	}
+	taxonomy, err := config.LoadTaxonomy(client)
+	if err != nil {
+		response.Write(w, response.Internal(err))
+		return
+	}
+	if !validateSubscription(w, &subscriptionReq, taxonomy) {
+		return
+	}
+
+	updateResult, err := db.UpdateOne(client, "apps", "subscriptions",
+		bson.D{{Key: "email", Value: user.Email}},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "name", Value: user.Name},
+			{Key: "sections", Value: subscriptionReq.Sections},
+			{Key: "frequency", Value: subscriptionReq.Frequency},
+		}}},
+	)
+	if err != nil {
+		response.Write(w, response.Internal(err))
+		return
+	}
+	if updateResult.MatchedCount == 0 {
+		// Only digests sent from now on are included
+		_, err = db.InsertOne(client, "apps", "subscriptions", bson.D{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "email", Value: user.Email},
+			{Key: "name", Value: user.Name},
+			{Key: "sections", Value: subscriptionReq.Sections},
+			{Key: "frequency", Value: subscriptionReq.Frequency},
+			{Key: "createdAt", Value: time.Now()},
+		})
+		if err != nil {
+			response.Write(w, response.Internal(err))
+			return
+		}
+	}
+	// Subscribing again undoes an earlier unsubscribe from the digest
+	if err := mail.Resubscribe(client, user.Email, mail.ListDigest); err != nil {
+		response.Write(w, response.Internal(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte("{\"Status\": \"OK\"}"))
+})
+
+// DELETE /digest/subscription
+var subscriptionDeleteHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	user, success := getUser(r.Header.Get("authorization"))
+	if !success {
+		response.Write(w, response.Unauthorized("You do not have access to digest subscriptions."))
+		return
+	}
+
+	deleteResult, err := db.DeleteOne(client, "apps", "subscriptions", bson.D{{Key: "email", Value: user.Email}})
+	if err != nil {
+		response.Write(w, response.Internal(err))
+		return
+	}
+	if deleteResult.DeletedCount < 1 {
+		response.Write(w, response.NotFound("You are not subscribed to the digest."))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte("{\"Status\": \"OK\"}"))
+})
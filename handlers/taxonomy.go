@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"hoagie-profile/config"
+	"hoagie-profile/response"
+	"net/http"
+)
+
+// GET /stuff/taxonomy lists the categories of posts and the tags allowed
+// in each, with their display names and emoji
+var stuffTaxonomyHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	if _, success := getUser(r.Header.Get("authorization")); !success {
+		response.Write(w, response.Unauthorized("You do not have access to the Hoagie API."))
+		return
+	}
+
+	taxonomy, err := config.LoadTaxonomy(client)
+	if err != nil {
+		response.Write(w, response.Internal(err))
+		return
+	}
+	response.JSON(w, http.StatusOK, taxonomy)
+})
+
+// PUT /admin/stuff/taxonomy
+var taxonomyUpdateHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	admin, success := getAdmin(w, r.Header.Get("authorization"), "You do not have access to the categories.")
+	if !success {
+		return
+	}
+
+	var taxonomy config.Taxonomy
+	if err := json.NewDecoder(r.Body).Decode(&taxonomy); err != nil {
+		response.Write(w, response.BadRequest("Categories did not contain correct fields."))
+		return
+	}
+	for i := range taxonomy.Categories {
+		if taxonomy.Categories[i].Tags == nil {
+			taxonomy.Categories[i].Tags = []config.Tag{}
+		}
+	}
+	if err := taxonomy.Validate(); err != nil {
+		response.Write(w, response.Invalid("categories", fmt.Sprintf("Invalid categories: %s.", err.Error())))
+		return
+	}
+
+	if err := config.SaveTaxonomy(client, taxonomy); err != nil {
+		response.Write(w, response.Internal(err))
+		return
+	}
+	fmt.Printf("TAXONOMY: %s updated the categories.\n", admin.Email)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte("{\"Status\": \"OK\"}"))
+})
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"hoagie-profile/config"
+)
+
+// The default taxonomy with a renamed category in every group
+func renamedTaxonomy(t *testing.T) config.Taxonomy {
+	t.Helper()
+	taxonomy := config.DefaultTaxonomy()
+	renames := map[string]string{"lost": "lost-items", "sale": "market", "bulletin": "notices"}
+	for i, category := range taxonomy.Categories {
+		if key, ok := renames[category.Key]; ok {
+			taxonomy.Categories[i].Key = key
+		}
+	}
+	if err := taxonomy.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	return taxonomy
+}
+
+func TestRenamedCategoriesKeepTheRulesOfTheirGroup(t *testing.T) {
+	taxonomy := renamedTaxonomy(t)
+	lostFound := &LostFoundInfo{Kind: "found", Date: time.Now(), Location: "butler", ItemType: "keys"}
+	marketplace := &MarketplaceInfo{Price: 1500, Condition: "good"}
+
+	tests := []struct {
+		name     string
+		post     PostData
+		validate func(w *httptest.ResponseRecorder, post *PostData) bool
+		want     bool
+	}{
+		{
+			name:     "lost & found posts need their details",
+			post:     PostData{Category: "lost-items"},
+			validate: func(w *httptest.ResponseRecorder, post *PostData) bool { return validateLostFound(w, post, taxonomy) },
+		},
+		{
+			name:     "lost & found details",
+			post:     PostData{Category: "lost-items", LostFound: lostFound},
+			validate: func(w *httptest.ResponseRecorder, post *PostData) bool { return validateLostFound(w, post, taxonomy) },
+			want:     true,
+		},
+		{
+			name:     "lost & found details on a marketplace post",
+			post:     PostData{Category: "market", LostFound: lostFound},
+			validate: func(w *httptest.ResponseRecorder, post *PostData) bool { return validateLostFound(w, post, taxonomy) },
+		},
+		{
+			name:     "marketplace posts need their details",
+			post:     PostData{Category: "market"},
+			validate: func(w *httptest.ResponseRecorder, post *PostData) bool { return validateMarketplace(w, post, taxonomy) },
+		},
+		{
+			name:     "marketplace details",
+			post:     PostData{Category: "market", Marketplace: marketplace},
+			validate: func(w *httptest.ResponseRecorder, post *PostData) bool { return validateMarketplace(w, post, taxonomy) },
+			want:     true,
+		},
+		{
+			name:     "marketplace links",
+			post:     PostData{Category: "market", Title: "Desk", Description: "A desk.", Link: "https://example.com/"},
+			validate: func(w *httptest.ResponseRecorder, post *PostData) bool { return validatePost(w, *post, taxonomy) },
+		},
+		{
+			name:     "bulletin titles",
+			post:     PostData{Category: "notices", Title: "Hi", Description: "Free pizza in Frist."},
+			validate: func(w *httptest.ResponseRecorder, post *PostData) bool { return validatePost(w, *post, taxonomy) },
+		},
+		{
+			name:     "bulletin",
+			post:     PostData{Category: "notices", Title: "Free pizza", Description: "Free pizza in Frist."},
+			validate: func(w *httptest.ResponseRecorder, post *PostData) bool { return validatePost(w, *post, taxonomy) },
+			want:     true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			if got := test.validate(w, &test.post); got != test.want {
+				t.Errorf("valid = %t, want %t: %s", got, test.want, w.Body.String())
+			}
+		})
+	}
+}
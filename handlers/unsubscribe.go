@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"hoagie-profile/db"
+	"hoagie-profile/mail"
+	"hoagie-profile/response"
+	"html"
+	"net/http"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Names of the emails users can unsubscribe from, as shown to them
+var listNames = map[string]string{
+	mail.ListDigest:  "your personal Hoagie Stuff digest",
+	mail.ListAlerts:  "saved search alerts",
+	mail.ListMatches: "lost & found match suggestions",
+	mail.ListContact: "messages from buyers about your posts",
+}
+
+// Unsubscribes a user from a list. Unsubscribing from the digest also
+// removes their digest subscription.
+func unsubscribe(email string, list string) error {
+	if err := mail.Unsubscribe(client, email, list); err != nil {
+		return err
+	}
+	if list == mail.ListDigest {
+		_, err := db.DeleteOne(client, "apps", "subscriptions", bson.D{{Key: "email", Value: email}})
+		return err
+	}
+	return nil
+}
+
+func writeUnsubscribePage(w http.ResponseWriter, status int, body string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write([]byte(`<div style="font-family: sans-serif;">` + body +
+		`<p>Manage your emails anytime on <a href="https://stuff.hoagie.io/">Hoagie Stuff</a>.</p></div>`))
+}
+
+// GET /unsubscribe asks to confirm, so that mail scanners opening the link
+// do not unsubscribe anyone
+var unsubscribePageHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	email, list, err := mail.ParseUnsubscribeToken(token)
+	if err != nil {
+		writeUnsubscribePage(w, http.StatusBadRequest, "<p>This unsubscribe link is invalid.</p>")
+		return
+	}
+	writeUnsubscribePage(w, http.StatusOK, fmt.Sprintf(
+		`<p>Stop sending %s to %s?</p>`+
+			`<form method="POST" action="?token=%s"><button type="submit">Unsubscribe</button></form>`,
+		listNames[list], html.EscapeString(email), html.EscapeString(token)))
+})
+
+// POST /unsubscribe is the RFC 8058 one-click unsubscribe of the
+// List-Unsubscribe header, and the form of the unsubscribe page
+var unsubscribeHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	email, list, err := mail.ParseUnsubscribeToken(r.URL.Query().Get("token"))
+	if err != nil {
+		writeUnsubscribePage(w, http.StatusBadRequest, "<p>This unsubscribe link is invalid.</p>")
+		return
+	}
+	if err := unsubscribe(email, list); err != nil {
+		writeUnsubscribePage(w, http.StatusInternalServerError, "<p>Hoagie Stuff had an error, please try again.</p>")
+		return
+	}
+	fmt.Printf("UNSUBSCRIBE: %s from %s.\n", email, list)
+	writeUnsubscribePage(w, http.StatusOK, fmt.Sprintf("<p>You will no longer get %s.</p>", listNames[list]))
+})
+
+// GET /preferences
+var preferencesHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	user, success := getUser(r.Header.Get("authorization"))
+	if !success {
+		response.Write(w, response.Unauthorized("You do not have access to email preferences."))
+		return
+	}
+
+	preferences, err := mail.GetPreferences(client, user.Email)
+	if err != nil {
+		response.Write(w, response.Internal(err))
+		return
+	}
+	response.JSON(w, http.StatusOK, preferences)
+})
+
+// PUT /preferences replaces the lists the user is unsubscribed from
+var preferencesUpdateHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	user, success := getUser(r.Header.Get("authorization"))
+	if !success {
+		response.Write(w, response.Unauthorized("You do not have access to email preferences."))
+		return
+	}
+
+	var preferencesReq mail.Preferences
+	if err := json.NewDecoder(r.Body).Decode(&preferencesReq); err != nil {
+		response.Write(w, response.BadRequest("Preferences did not contain correct fields."))
+		return
+	}
+	unsubscribed := []string{}
+	seen := map[string]bool{}
+	for _, list := range preferencesReq.Unsubscribed {
+		if !mail.IsList(list) {
+			response.Write(w, response.Invalid("unsubscribed", fmt.Sprintf("Invalid email list: %s.", list)))
+			return
+		}
+		if !seen[list] {
+			seen[list] = true
+			unsubscribed = append(unsubscribed, list)
+		}
+	}
+
+	if err := mail.SetUnsubscribed(client, user.Email, unsubscribed); err != nil {
+		response.Write(w, response.Internal(err))
+		return
+	}
+	if seen[mail.ListDigest] {
+		if err := unsubscribe(user.Email, mail.ListDigest); err != nil {
+			response.Write(w, response.Internal(err))
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte("{\"Status\": \"OK\"}"))
+})
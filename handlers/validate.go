@@ -2,19 +2,22 @@ package handlers
 
 import (
 	"fmt"
+	"hoagie-profile/response"
 	"net/http"
 	"time"
 )
 
-func notBetween(w http.ResponseWriter, input string, inputName string, minChar int, maxChar int) bool {
+// Writes an error for the given field and returns true if the input is
+// not between the given numbers of characters
+func notBetween(w http.ResponseWriter, field string, input string, inputName string, minChar int, maxChar int) bool {
 	if len(input) < minChar {
 		responseString := fmt.Sprintf("Please keep your %s over the %d-character requirement.", inputName, minChar)
-		http.Error(w, responseString, http.StatusForbidden)
+		response.Write(w, response.Invalid(field, responseString))
 		return true
 	}
 	if len(input) > maxChar {
 		responseString := fmt.Sprintf("Please keep your %s under the %d-character limit.", inputName, maxChar)
-		http.Error(w, responseString, http.StatusForbidden)
+		response.Write(w, response.Invalid(field, responseString))
 		return true
 	}
 	return false
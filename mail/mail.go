@@ -0,0 +1,231 @@
+package mail
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hoagie-profile/db"
+	"net/http"
+	"os"
+	"time"
+
+	mailjet "github.com/mailjet/mailjet-apiv3-go"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Address every Hoagie email is sent from
+const FROM_EMAIL = "hoagie@princeton.edu"
+
+// Mailjet accepts at most 50 messages per send request
+const BATCH_SIZE = 50
+
+const SEND_URL = "https://api.mailjet.com/v3.1/send"
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// An email sent directly to a single recipient, such as a notification
+type Message struct {
+	To          string
+	ToName      string
+	ReplyTo     string
+	ReplyToName string
+	Subject     string
+	HTML        string
+	Text        string
+	// Groups messages of the same kind in Mailjet statistics
+	CustomID string
+	// Kind of email the recipient can unsubscribe from, such as ListAlerts.
+	// Messages with a list get one-click unsubscribe headers and are not
+	// sent to users who unsubscribed from it.
+	List string
+}
+
+// The Mailjet client does not support custom headers, so messages are
+// posted to the send API directly
+type infoMessage struct {
+	mailjet.InfoMessagesV31
+	Headers map[string]string `json:",omitempty"`
+}
+
+func (message Message) info(sender string) infoMessage {
+	info := mailjet.InfoMessagesV31{
+		From: &mailjet.RecipientV31{
+			Email: FROM_EMAIL,
+			Name:  sender,
+		},
+		To: &mailjet.RecipientsV31{
+			mailjet.RecipientV31{
+				Email: message.To,
+				Name:  message.ToName,
+			},
+		},
+		Subject:  message.Subject,
+		TextPart: message.Text,
+		HTMLPart: message.HTML,
+		CustomID: message.CustomID,
+	}
+	if message.ReplyTo != "" {
+		info.ReplyTo = &mailjet.RecipientV31{
+			Email: message.ReplyTo,
+			Name:  message.ReplyToName,
+		}
+	}
+	if message.List == "" {
+		return infoMessage{InfoMessagesV31: info}
+	}
+	return infoMessage{InfoMessagesV31: info, Headers: unsubscribeHeaders(message.To, message.List)}
+}
+
+// Send messages in batches through Mailjet under the given sender name.
+// Every message is recorded in apps.sent so that delivery events are
+// tracked. In debug mode, messages are only printed.
+func Send(client *mongo.Client, sender string, messages []Message) error {
+	messages, err := withoutUnsubscribed(client, messages)
+	if err != nil {
+		return err
+	}
+	for _, message := range messages {
+		if message.List != "" && len(unsubscribeSecret()) == 0 && os.Getenv("HOAGIE_MODE") != "debug" {
+			return fmt.Errorf("HOAGIE_UNSUBSCRIBE_SECRET must be set to send %s emails", message.List)
+		}
+	}
+	for start := 0; start < len(messages); start += BATCH_SIZE {
+		end := start + BATCH_SIZE
+		if end > len(messages) {
+			end = len(messages)
+		}
+		if err := sendBatch(client, sender, messages[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Tags a message with the ID of its record in apps.sent, so that Mailjet
+// delivery events can be matched back to it. The email is the user the
+// message is recorded for.
+func track(info *mailjet.InfoMessagesV31, id primitive.ObjectID, email string) db.SentMessage {
+	info.EventPayload = id.Hex()
+	return db.SentMessage{
+		Id:       id,
+		Email:    email,
+		Header:   info.Subject,
+		CustomID: info.CustomID,
+	}
+}
+
+// Records a message that Mailjet accepted, with the message ID it
+// generated for every recipient
+func recordSent(client *mongo.Client, sent db.SentMessage, result mailjet.ResultV31) (db.SentMessage, error) {
+	for _, recipients := range [][]mailjet.GeneratedMessageV31{result.To, result.Cc, result.Bcc} {
+		for _, generated := range recipients {
+			sent.MessageIDs = append(sent.MessageIDs, generated.MessageID)
+		}
+	}
+	sent.Recipients = len(sent.MessageIDs)
+	return sent, db.RecordSent(client, sent)
+}
+
+// Returned by SendTracked when the message was sent but could not be
+// recorded, so it must not be sent again
+var ErrNotRecorded = errors.New("message was sent but could not be recorded")
+
+// Sends a single message as given, such as a blast copied to every
+// listserv, and records it in apps.sent under the given ID for the given
+// user. Returns the record, with the Mailjet message ID of every recipient.
+// Unlike Send, the message is sent even in debug mode.
+func SendTracked(client *mongo.Client, id primitive.ObjectID, email string, info mailjet.InfoMessagesV31) (db.SentMessage, error) {
+	sent := track(&info, id, email)
+	res, err := post([]infoMessage{{InfoMessagesV31: info}})
+	if err != nil {
+		return sent, err
+	}
+	if len(res.ResultsV31) == 0 || res.ResultsV31[0].Status != "success" {
+		return sent, fmt.Errorf("mail service received an error, possibly because of limits")
+	}
+	sent, err = recordSent(client, sent, res.ResultsV31[0])
+	if err != nil {
+		return sent, fmt.Errorf("%w: %s", ErrNotRecorded, err)
+	}
+	return sent, nil
+}
+
+func sendBatch(client *mongo.Client, sender string, batch []Message) error {
+	var messagesInfo []infoMessage
+	var sent []db.SentMessage
+	for _, message := range batch {
+		info := message.info(sender)
+		sent = append(sent, track(&info.InfoMessagesV31, primitive.NewObjectID(), message.To))
+		messagesInfo = append(messagesInfo, info)
+	}
+
+	if os.Getenv("HOAGIE_MODE") == "debug" {
+		for _, message := range batch {
+			fmt.Printf("To: %s\nSubject: %s\nBody: %s\n\n", message.To, message.Subject, message.Text)
+		}
+		return nil
+	}
+
+	res, err := post(messagesInfo)
+	if err != nil {
+		return err
+	}
+	if len(res.ResultsV31) != len(batch) {
+		return fmt.Errorf("mail service received an error, possibly because of limits")
+	}
+
+	failed := 0
+	for i, result := range res.ResultsV31 {
+		if result.Status != "success" {
+			failed++
+			continue
+		}
+		if _, err := recordSent(client, sent[i], result); err != nil {
+			fmt.Println("Error recording sent mail:", err)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("mail service failed to send %d of %d messages", failed, len(batch))
+	}
+	return nil
+}
+
+// Posts messages to the Mailjet send API, as mailjet.SendMailV31 does
+func post(messagesInfo []infoMessage) (*mailjet.ResultsV31, error) {
+	data, err := json.Marshal(map[string][]infoMessage{"Messages": messagesInfo})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", SEND_URL, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(os.Getenv("MAILJET_PUBLIC_KEY"), os.Getenv("MAILJET_PRIVATE_KEY"))
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	decoder := json.NewDecoder(res.Body)
+	switch res.StatusCode {
+	case http.StatusOK:
+		var results mailjet.ResultsV31
+		if err := decoder.Decode(&results); err != nil {
+			return nil, err
+		}
+		return &results, nil
+	case http.StatusBadRequest, http.StatusForbidden:
+		var feedback mailjet.APIFeedbackErrorsV31
+		if err := decoder.Decode(&feedback); err != nil {
+			return nil, err
+		}
+		return nil, &feedback
+	default:
+		return nil, fmt.Errorf("mail service returned %s", res.Status)
+	}
+}
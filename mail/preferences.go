@@ -0,0 +1,115 @@
+package mail
+
+import (
+	"context"
+	"time"
+
+	"hoagie-profile/db"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var REQUEST_TIMEOUT = 10 * time.Second
+
+// Email preferences of a user, kept in apps.preferences. Users get every
+// kind of email until they unsubscribe from it.
+type Preferences struct {
+	Email        string    `json:"email" bson:"email"`
+	Unsubscribed []string  `json:"unsubscribed" bson:"unsubscribed"`
+	UpdatedAt    time.Time `json:"updatedAt" bson:"updatedAt"`
+}
+
+func (preferences Preferences) IsUnsubscribed(list string) bool {
+	for _, unsubscribed := range preferences.Unsubscribed {
+		if unsubscribed == list {
+			return true
+		}
+	}
+	return false
+}
+
+// Get the preferences of a user, who has not unsubscribed from anything
+// if they have none
+func GetPreferences(client *mongo.Client, email string) (Preferences, error) {
+	preferences := Preferences{Email: email, Unsubscribed: []string{}}
+	err := db.FindOne(client, "apps", "preferences", bson.D{{Key: "email", Value: email}}, &preferences)
+	if err == mongo.ErrNoDocuments {
+		return preferences, nil
+	}
+	return preferences, err
+}
+
+// Replace the lists a user is unsubscribed from
+func SetUnsubscribed(client *mongo.Client, email string, lists []string) error {
+	_, err := db.UpsertOne(client, "apps", "preferences",
+		bson.D{{Key: "email", Value: email}},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "unsubscribed", Value: lists},
+			{Key: "updatedAt", Value: time.Now()},
+		}}},
+	)
+	return err
+}
+
+func Unsubscribe(client *mongo.Client, email string, list string) error {
+	_, err := db.UpsertOne(client, "apps", "preferences",
+		bson.D{{Key: "email", Value: email}},
+		bson.D{
+			{Key: "$addToSet", Value: bson.D{{Key: "unsubscribed", Value: list}}},
+			{Key: "$set", Value: bson.D{{Key: "updatedAt", Value: time.Now()}}},
+		},
+	)
+	return err
+}
+
+func Resubscribe(client *mongo.Client, email string, list string) error {
+	_, err := db.UpdateOne(client, "apps", "preferences",
+		bson.D{{Key: "email", Value: email}},
+		bson.D{
+			{Key: "$pull", Value: bson.D{{Key: "unsubscribed", Value: list}}},
+			{Key: "$set", Value: bson.D{{Key: "updatedAt", Value: time.Now()}}},
+		},
+	)
+	return err
+}
+
+// Leaves out the messages to users who unsubscribed from their list
+func withoutUnsubscribed(client *mongo.Client, messages []Message) ([]Message, error) {
+	var emails []string
+	for _, message := range messages {
+		if message.List != "" {
+			emails = append(emails, message.To)
+		}
+	}
+	if len(emails) == 0 {
+		return messages, nil
+	}
+
+	filter := bson.D{{Key: "email", Value: bson.D{{Key: "$in", Value: emails}}}}
+	cursor, err := db.FindMany(client, "apps", "preferences", filter, options.Find())
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), REQUEST_TIMEOUT)
+	defer cancel()
+	defer cursor.Close(ctx)
+
+	var found []Preferences
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, err
+	}
+	byEmail := map[string]Preferences{}
+	for _, preferences := range found {
+		byEmail[preferences.Email] = preferences
+	}
+	var allowed []Message
+	for _, message := range messages {
+		if message.List != "" && byEmail[message.To].IsUnsubscribed(message.List) {
+			continue
+		}
+		allowed = append(allowed, message)
+	}
+	return allowed, nil
+}
@@ -0,0 +1,93 @@
+package mail
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Kinds of email users can unsubscribe from
+const (
+	// Personal digests, see digest.SendPersonal
+	ListDigest = "digest"
+	// Saved search alerts, see cmd/alerts
+	ListAlerts = "alerts"
+	// Lost & found match suggestions, see cmd/match
+	ListMatches = "matches"
+	// Messages from buyers through the contact relay
+	ListContact = "contact"
+)
+
+var Lists = []string{ListDigest, ListAlerts, ListMatches, ListContact}
+
+func IsList(list string) bool {
+	for _, known := range Lists {
+		if list == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Unsubscribe tokens are signed with HOAGIE_UNSUBSCRIBE_SECRET, so that
+// nobody can unsubscribe someone else
+func unsubscribeSecret() []byte {
+	return []byte(os.Getenv("HOAGIE_UNSUBSCRIBE_SECRET"))
+}
+
+func signature(email string, list string) []byte {
+	mac := hmac.New(sha256.New, unsubscribeSecret())
+	mac.Write([]byte(email + "\n" + list))
+	return mac.Sum(nil)
+}
+
+// Returns the token of the unsubscribe link of an email and list, in the
+// form email.list.signature with the email and signature base64 encoded
+func UnsubscribeToken(email string, list string) string {
+	encoding := base64.RawURLEncoding
+	return strings.Join([]string{
+		encoding.EncodeToString([]byte(email)),
+		list,
+		encoding.EncodeToString(signature(email, list)),
+	}, ".")
+}
+
+// Returns the email and list of a valid unsubscribe token
+func ParseUnsubscribeToken(token string) (string, string, error) {
+	if len(unsubscribeSecret()) == 0 {
+		return "", "", fmt.Errorf("unsubscribe links are not set up")
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || !IsList(parts[1]) {
+		return "", "", fmt.Errorf("invalid unsubscribe token")
+	}
+	encoding := base64.RawURLEncoding
+	email, err := encoding.DecodeString(parts[0])
+	if err != nil {
+		return "", "", fmt.Errorf("invalid unsubscribe token")
+	}
+	given, err := encoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(given, signature(string(email), parts[1])) {
+		return "", "", fmt.Errorf("invalid unsubscribe token")
+	}
+	return string(email), parts[1], nil
+}
+
+// Returns the one-click unsubscribe link of an email and list, which is
+// also the target of the List-Unsubscribe header
+func UnsubscribeURL(email string, list string) string {
+	return fmt.Sprintf("https://%s/unsubscribe/?token=%s", os.Getenv("HOAGIE_HOST"), url.QueryEscape(UnsubscribeToken(email, list)))
+}
+
+// RFC 8058 one-click unsubscribe headers, which Gmail and Yahoo require
+// from bulk senders
+func unsubscribeHeaders(email string, list string) map[string]string {
+	return map[string]string{
+		"List-Unsubscribe":      "<" + UnsubscribeURL(email, list) + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}
+}
@@ -0,0 +1,91 @@
+package mail
+
+import (
+	"encoding/base64"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestUnsubscribeTokenRoundTrip(t *testing.T) {
+	t.Setenv("HOAGIE_UNSUBSCRIBE_SECRET", "test-secret")
+	for _, list := range Lists {
+		for _, email := range []string{"veggie@princeton.edu", "tiger.prowl+stuff@princeton.edu"} {
+			parsedEmail, parsedList, err := ParseUnsubscribeToken(UnsubscribeToken(email, list))
+			if err != nil {
+				t.Fatalf("%s %s: %s", email, list, err)
+			}
+			if parsedEmail != email || parsedList != list {
+				t.Errorf("parsed %s %s, want %s %s", parsedEmail, parsedList, email, list)
+			}
+		}
+	}
+}
+
+func TestUnsubscribeTokenRejectsTampering(t *testing.T) {
+	t.Setenv("HOAGIE_UNSUBSCRIBE_SECRET", "test-secret")
+	token := UnsubscribeToken("veggie@princeton.edu", ListAlerts)
+	parts := strings.Split(token, ".")
+	otherEmail := base64.RawURLEncoding.EncodeToString([]byte("meat@princeton.edu"))
+	flipped := []byte(parts[2])
+	if flipped[0] == 'A' {
+		flipped[0] = 'B'
+	} else {
+		flipped[0] = 'A'
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"empty", ""},
+		{"other email", strings.Join([]string{otherEmail, parts[1], parts[2]}, ".")},
+		{"other list", strings.Join([]string{parts[0], ListDigest, parts[2]}, ".")},
+		{"unknown list", strings.Join([]string{parts[0], "newsletter", parts[2]}, ".")},
+		{"changed signature", strings.Join([]string{parts[0], parts[1], string(flipped)}, ".")},
+		{"missing signature", strings.Join(parts[:2], ".")},
+		{"extra part", token + ".extra"},
+		{"invalid email encoding", strings.Join([]string{"!!!", parts[1], parts[2]}, ".")},
+		{"invalid signature encoding", strings.Join([]string{parts[0], parts[1], "!!!"}, ".")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, _, err := ParseUnsubscribeToken(test.token); err == nil {
+				t.Errorf("ParseUnsubscribeToken(%q) succeeded, want an error", test.token)
+			}
+		})
+	}
+}
+
+func TestUnsubscribeTokenNeedsTheSameSecret(t *testing.T) {
+	t.Setenv("HOAGIE_UNSUBSCRIBE_SECRET", "test-secret")
+	token := UnsubscribeToken("veggie@princeton.edu", ListMatches)
+
+	t.Setenv("HOAGIE_UNSUBSCRIBE_SECRET", "rotated-secret")
+	if _, _, err := ParseUnsubscribeToken(token); err == nil {
+		t.Errorf("token signed with another secret was accepted")
+	}
+	// Without a secret, tokens could be forged, so none are accepted
+	t.Setenv("HOAGIE_UNSUBSCRIBE_SECRET", "")
+	if _, _, err := ParseUnsubscribeToken(UnsubscribeToken("veggie@princeton.edu", ListMatches)); err == nil {
+		t.Errorf("token was accepted without a secret")
+	}
+}
+
+func TestUnsubscribeHeaders(t *testing.T) {
+	t.Setenv("HOAGIE_UNSUBSCRIBE_SECRET", "test-secret")
+	t.Setenv("HOAGIE_HOST", "api.hoagie.io")
+	headers := unsubscribeHeaders("veggie@princeton.edu", ListDigest)
+	if headers["List-Unsubscribe-Post"] != "List-Unsubscribe=One-Click" {
+		t.Errorf("List-Unsubscribe-Post = %q", headers["List-Unsubscribe-Post"])
+	}
+	link := strings.TrimSuffix(strings.TrimPrefix(headers["List-Unsubscribe"], "<"), ">")
+	parsed, err := url.Parse(link)
+	if err != nil || parsed.Host != "api.hoagie.io" || parsed.Path != "/unsubscribe/" {
+		t.Fatalf("List-Unsubscribe = %q", headers["List-Unsubscribe"])
+	}
+	email, list, err := ParseUnsubscribeToken(parsed.Query().Get("token"))
+	if err != nil || email != "veggie@princeton.edu" || list != ListDigest {
+		t.Errorf("link unsubscribes %s from %s (%v)", email, list, err)
+	}
+}
@@ -0,0 +1,131 @@
+package response
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+)
+
+// Machine-readable codes of API errors
+const (
+	CodeBadRequest    = "bad_request"
+	CodeUnauthorized  = "unauthorized"
+	CodeForbidden     = "forbidden"
+	CodeNotFound      = "not_found"
+	CodeConflict      = "conflict"
+	CodeQuotaExceeded = "quota_exceeded"
+	CodeInvalid       = "invalid"
+	CodeRateLimited   = "rate_limited"
+	CodeInternal      = "internal"
+	CodeUnavailable   = "unavailable"
+)
+
+// An error returned by the API, written as
+// {"error": {"code": ..., "message": ..., "fields": ...}}
+type Error struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Messages of the invalid fields of the request, by field name
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func New(status int, code string, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// The request is malformed, such as a body that is not valid JSON
+func BadRequest(message string) *Error {
+	return New(http.StatusBadRequest, CodeBadRequest, message)
+}
+
+// The user is not logged in
+func Unauthorized(message string) *Error {
+	return New(http.StatusUnauthorized, CodeUnauthorized, message)
+}
+
+// The user is logged in but may not do this
+func Forbidden(message string) *Error {
+	return New(http.StatusForbidden, CodeForbidden, message)
+}
+
+func NotFound(message string) *Error {
+	return New(http.StatusNotFound, CodeNotFound, message)
+}
+
+// The request conflicts with the current state, such as editing a post
+// that was already sent
+func Conflict(message string) *Error {
+	return New(http.StatusConflict, CodeConflict, message)
+}
+
+// The user has reached the number of items they may have at once
+func QuotaExceeded(message string) *Error {
+	return New(http.StatusConflict, CodeQuotaExceeded, message)
+}
+
+// A field of the request is invalid
+func Invalid(field string, message string) *Error {
+	err := New(http.StatusUnprocessableEntity, CodeInvalid, message)
+	err.Fields = map[string]string{field: message}
+	return err
+}
+
+func TooManyRequests(message string) *Error {
+	return New(http.StatusTooManyRequests, CodeRateLimited, message)
+}
+
+// A feature the request needs is not set up on this server, such as
+// image storage
+func Unavailable(message string) *Error {
+	return New(http.StatusServiceUnavailable, CodeUnavailable, message)
+}
+
+// An unexpected error, which is logged rather than shown to the user
+func Internal(err error) *Error {
+	fmt.Println("ERROR:", err)
+	return New(http.StatusInternalServerError, CodeInternal, "Hoagie had an error, please try again.")
+}
+
+// Writes the error with its status
+func Write(w http.ResponseWriter, err *Error) {
+	body, _ := json.Marshal(map[string]*Error{"error": err})
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(err.Status)
+	w.Write(body)
+}
+
+// Writes the value as JSON with the given status
+func JSON(w http.ResponseWriter, status int, value interface{}) {
+	body, err := json.Marshal(value)
+	if err != nil {
+		Write(w, Internal(fmt.Errorf("marshalling response: %s", err)))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// Middleware that turns a panic of a handler into an internal error,
+// instead of closing the connection
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				if recovered == http.ErrAbortHandler {
+					panic(recovered)
+				}
+				fmt.Printf("PANIC: %s %s: %v\n%s", r.Method, r.URL.Path, recovered, debug.Stack())
+				Write(w, Internal(fmt.Errorf("panic: %v", recovered)))
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}